@@ -0,0 +1,47 @@
+package bimultimap
+
+import "slices"
+
+// BiMap is a thread-safe bidirectional map where every key has exactly one value. Values do not need
+// to be unique, so a value can still be associated with several keys
+type BiMap[K comparable, V comparable] struct {
+	m *BiMultiMap[K, V]
+}
+
+// NewBiMap creates a new, empty BiMap
+func NewBiMap[K comparable, V comparable]() *BiMap[K, V] {
+	return &BiMap[K, V]{m: New[K, V]()}
+}
+
+// Set associates a key with a value, replacing the value the key had before, if any
+func (b *BiMap[K, V]) Set(key K, value V) {
+	b.m.mutex.Lock()
+	defer b.m.unlock()
+
+	for _, v := range slices.Clone(b.m.forward[key]) {
+		if v != value {
+			b.m.deleteKeyValue(key, v)
+		}
+	}
+	b.m.add(key, value)
+}
+
+// Get returns the value associated with a key, and false if the key does not exist
+func (b *BiMap[K, V]) Get(key K) (V, bool) {
+	return b.m.FirstValue(key)
+}
+
+// GetKey returns the keys associated with a value, or an empty slice if the value does not exist
+func (b *BiMap[K, V]) GetKey(value V) []K {
+	return b.m.LookupValue(value)
+}
+
+// Delete deletes a key from the map and returns its value, and false if the key did not exist
+func (b *BiMap[K, V]) Delete(key K) (V, bool) {
+	values := b.m.DeleteKey(key)
+	if len(values) == 0 {
+		var zero V
+		return zero, false
+	}
+	return values[0], true
+}
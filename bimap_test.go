@@ -0,0 +1,41 @@
+package bimultimap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBiMapSet(t *testing.T) {
+	sut := NewBiMap[string, string]()
+	sut.Set("key", "value1")
+	sut.Set("key", "value2")
+
+	value, found := sut.Get("key")
+	assert.True(t, found, "the key should be found")
+	assert.Equal(t, "value2", value, "Set should replace the previous value")
+	assert.Empty(t, sut.GetKey("value1"), "the previous value should be removed from the inverse")
+
+	sut.Set("key", "value2")
+	value, _ = sut.Get("key")
+	assert.Equal(t, "value2", value, "setting the same value again should keep it")
+
+	_, found = sut.Get("foo")
+	assert.False(t, found, "a nonexistent key should not be found")
+}
+
+func TestBiMapGetKey(t *testing.T) {
+	sut := NewBiMap[string, string]()
+	sut.Set("key1", "value")
+	sut.Set("key2", "value")
+
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.GetKey("value"), "a value can have several keys")
+
+	value, found := sut.Delete("key1")
+	assert.True(t, found, "deleting an existing key should succeed")
+	assert.Equal(t, "value", value, "the deleted key's value should be returned")
+	assert.Equal(t, []string{"key2"}, sut.GetKey("value"), "the deleted key should be removed from the inverse")
+
+	_, found = sut.Delete("key1")
+	assert.False(t, found, "deleting a nonexistent key should fail")
+}
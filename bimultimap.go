@@ -3,26 +3,167 @@
 package bimultimap
 
 import (
+	"cmp"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unsafe"
 )
 
+// mapEntryOverhead is a rough per-entry estimate of the bookkeeping a Go map needs on top of the
+// key and element themselves (hash bits, bucket slack, overflow pointers)
+const mapEntryOverhead = 16
+
 // BiMultiMap is a thread-safe bidirectional multimap where neither the keys nor the values need to be unique
 type BiMultiMap[K comparable, V comparable] struct {
 	forward map[K][]V
 	inverse map[V][]K
 	mutex   sync.RWMutex
+
+	// pairCount holds the number of occurrences of every key/value pair in the indexes, so that
+	// checking whether a pair exists does not need to scan the values of its key. The slices are still
+	// needed to keep the values of each key in insertion order, so deleting a single pair remains
+	// linear in the number of values of its key and keys of its value
+	pairCount map[Pair[K, V]]int
+
+	// multiset is true if a key/value pair is stored once per Add instead of being deduplicated
+	multiset bool
+
+	// autoCompact is true if slices are reallocated when deletions leave most of their capacity
+	// unused. See NewAutoCompacting
+	autoCompact bool
+
+	// keyGeneration is incremented whenever a key is added or removed, but not when only the values
+	// of an existing key change
+	keyGeneration uint64
+
+	// ordered is true if the insertion order of keys and pairs is tracked. sequence is incremented
+	// every time a key or pair is added, and keyOrder and pairOrder record its value at the time each
+	// key or pair was first added. See NewOrdered
+	ordered   bool
+	sequence  uint64
+	keyOrder  map[K]uint64
+	pairOrder map[Pair[K, V]]uint64
+
+	// retainEmptyKeys is true if ClearKey keeps the key in the map. See NewRetainingEmptyKeys
+	retainEmptyKeys bool
+
+	// validator checks every pair added with Add or AddValidated. See NewWithValidator
+	validator func(K, V) error
+
+	// keyCapacity is the maximum number of values per key, or zero if unlimited. See SetKeyCapacity
+	keyCapacity int
+
+	// ttl is the time after which a key/value pair expires, or zero if pairs never expire. now gets
+	// the current time, addedAt records when each pair was last added and expiries lists the pairs
+	// in the order they were added. See NewWithTTL
+	ttl      time.Duration
+	now      func() time.Time
+	addedAt  map[K]map[V]time.Time
+	expiries []expiry[K, V]
+
+	// version is incremented on every change. changes holds the most recent changes as a ring buffer
+	// starting at changesHead, and is complete for all versions after historyFrom
+	version     uint64
+	changes     []Change[K, V]
+	changesHead int
+	historyFrom uint64
+
+	// subscribers receive the events queued in pending once the write lock is released, and delivery
+	// keeps the events in order. See Subscribe
+	subscribers []*subscriber[K, V]
+	pending     []MutationEvent[K, V]
+	delivery    sync.Mutex
+
+	// modifiedAt records when each key last had a value added or removed. See NewWithClock
+	modifiedAt map[K]time.Time
+
+	// keyMeta holds the metadata attached to keys with SetKeyMeta. It is nil until first needed
+	keyMeta map[K]any
+
+	// lazyInverse is true if inverse is only a cache of the keys of the values that have been looked
+	// up, which is filled in while holding the read lock and therefore guarded by inverseMutex. See
+	// NewLazyInverse
+	lazyInverse  bool
+	inverseMutex sync.Mutex
+}
+
+// Pair is a single key/value association
+type Pair[K comparable, V comparable] struct {
+	Key   K
+	Value V
 }
 
 // New creates a new, empty biMultiMap
 func New[K comparable, V comparable]() *BiMultiMap[K, V] {
 	return &BiMultiMap[K, V]{
-		forward: make(map[K][]V),
-		inverse: make(map[V][]K),
+		forward:   make(map[K][]V),
+		inverse:   make(map[V][]K),
+		pairCount: make(map[Pair[K, V]]int),
+	}
+}
+
+// NewMultiset creates a new, empty BiMultiMap that keeps track of how many times each key/value pair
+// has been added. Every Add of a pair increments its multiplicity and every DeleteKeyValue decrements
+// it, and LookupKey and LookupValue return each element repeated according to its multiplicity.
+// DeleteKey and DeleteValue remove all occurrences
+func NewMultiset[K comparable, V comparable]() *BiMultiMap[K, V] {
+	m := New[K, V]()
+	m.multiset = true
+	return m
+}
+
+// Collect creates a new BiMultiMap containing all of the key/value pairs yielded by a sequence.
+// Duplicate pairs are only added once
+func Collect[K comparable, V comparable](seq iter.Seq2[K, V]) *BiMultiMap[K, V] {
+	m := New[K, V]()
+	for k, v := range seq {
+		m.add(k, v)
 	}
+	return m
+}
+
+// NewAutoCompacting creates a new, empty BiMultiMap that reallocates the slice holding the values of
+// a key (or the keys of a value) whenever a deletion leaves less than a quarter of its capacity in
+// use. By default deletions keep the capacity around so that it can be reused by later additions,
+// which makes maps with a lot of churn hold on to memory
+func NewAutoCompacting[K comparable, V comparable]() *BiMultiMap[K, V] {
+	m := New[K, V]()
+	m.autoCompact = true
+	return m
 }
 
-// LookupKey gets the values associated with a key, or an empty slice if the key does not exist
+// NewWithValidator creates a new, empty BiMultiMap that calls validate on every key/value pair
+// before it is added with Add, AddValidated, AddCross, AddMany, AddAll, Upsert,
+// ReplaceValueEverywhere, MergeIntoReturningAdded, RewriteValues, UnmarshalJSON or
+// UnmarshalMsgpack, and rejects the pair if validate returns an error. validate is called without
+// holding the map's lock, except by RewriteValues. Pairs that are moved within the map, e.g. by
+// RenameKeys, are not validated again
+func NewWithValidator[K comparable, V comparable](validate func(K, V) error) *BiMultiMap[K, V] {
+	m := New[K, V]()
+	m.validator = validate
+	return m
+}
+
+// NewRetainingEmptyKeys creates a new, empty BiMultiMap where ClearKey keeps the key in the map with
+// no values instead of removing it. All other deletions still remove keys that are left without
+// values
+func NewRetainingEmptyKeys[K comparable, V comparable]() *BiMultiMap[K, V] {
+	m := New[K, V]()
+	m.retainEmptyKeys = true
+	return m
+}
+
+// LookupKey gets a copy of the values associated with a key, or an empty slice if the key does not
+// exist. The returned slice can be freely modified without affecting the map
 func (m *BiMultiMap[K, V]) LookupKey(key K) []V {
+	m.expire()
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
@@ -30,52 +171,209 @@ func (m *BiMultiMap[K, V]) LookupKey(key K) []V {
 	if !found {
 		return make([]V, 0)
 	}
-	return values
+	return slices.Clone(values)
 }
 
-// LookupValue gets the keys associated with a value, or an empty slice if the value does not exist
+// LookupValue gets a copy of the keys associated with a value, or an empty slice if the value does not
+// exist. The returned slice can be freely modified without affecting the map
 func (m *BiMultiMap[K, V]) LookupValue(value V) []K {
+	m.expire()
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	keys, found := m.inverse[value]
+	keys := m.keysOf(value)
 
-	if !found {
+	if len(keys) == 0 {
 		return make([]K, 0)
 	}
-	return keys
+	return slices.Clone(keys)
 }
 
-// Add adds a key/value pair
-func (m *BiMultiMap[K, V]) Add(key K, value V) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+// CopyKeyEntry returns a key together with a copy of its values, and false if the key does not exist.
+// The returned slice can be freely modified without affecting the map
+func (m *BiMultiMap[K, V]) CopyKeyEntry(key K) (K, []V, bool) {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
 	values, found := m.forward[key]
 	if !found {
-		values = make([]V, 0, 1)
+		return key, nil, false
 	}
+	return key, slices.Clone(values), true
+}
 
-	// Value already exists for that key - early exit
+// LookupValueLimit gets a copy of at most limit of the keys associated with a value, in the order in
+// which they were associated with it, or all of them if limit is negative. It returns an empty slice
+// if the value does not exist
+func (m *BiMultiMap[K, V]) LookupValueLimit(value V, limit int) []K {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := m.keysOf(value)
+	if limit >= 0 && limit < len(keys) {
+		keys = keys[:limit]
+	}
+	return append(make([]K, 0, len(keys)), keys...)
+}
+
+// Add adds a key/value pair. Adding a pair that already exists is a no-op, unless the map was
+// created with NewMultiset. Pairs rejected by the validator of a map created with NewWithValidator
+// are silently ignored; use AddValidated to find out about them
+func (m *BiMultiMap[K, V]) Add(key K, value V) {
+	_ = m.AddValidated(key, value)
+}
+
+// AddValidated adds a key/value pair like Add, but returns the error from the map's validator if the
+// pair is rejected. It never fails for maps that were not created with NewWithValidator
+func (m *BiMultiMap[K, V]) AddValidated(key K, value V) error {
+	if m.validator != nil {
+		if err := m.validator(key, value); err != nil {
+			return err
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.unlock()
+
+	if m.ttl > 0 {
+		m.evictExpired()
+	}
+	m.add(key, value)
+	return nil
+}
+
+// AddCross adds every combination of one of the keys and one of the values under a single lock, so
+// that other goroutines never see only some of the pairs. Pairs that already exist are skipped like
+// with Add, and so are pairs rejected by the validator of a map created with NewWithValidator
+func (m *BiMultiMap[K, V]) AddCross(keys []K, values []V) {
+	pairs := make([]Pair[K, V], 0, len(keys)*len(values))
+	for _, k := range keys {
+		for _, v := range values {
+			if m.accepts(k, v) {
+				pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+			}
+		}
+	}
+	m.addPairs(pairs)
+}
+
+// AddMany adds several values to a key under a single lock, which is faster than adding them one by
+// one with Add. Pairs that already exist are skipped like with Add, and so are pairs rejected by the
+// validator of a map created with NewWithValidator
+func (m *BiMultiMap[K, V]) AddMany(key K, values ...V) {
+	pairs := make([]Pair[K, V], 0, len(values))
 	for _, v := range values {
-		if v == value {
-			return
+		if m.accepts(key, v) {
+			pairs = append(pairs, Pair[K, V]{Key: key, Value: v})
+		}
+	}
+	m.addPairs(pairs)
+}
+
+// AddAll adds all of the key/value pairs yielded by a sequence under a single lock, which is faster
+// than adding them one by one with Add. The sequence is drained before the lock is taken, so it may
+// access the map. Pairs that already exist are skipped like with Add, and so are pairs rejected by
+// the validator of a map created with NewWithValidator
+func (m *BiMultiMap[K, V]) AddAll(seq iter.Seq2[K, V]) {
+	pairs := make([]Pair[K, V], 0)
+	for k, v := range seq {
+		if m.accepts(k, v) {
+			pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
 		}
 	}
+	m.addPairs(pairs)
+}
+
+// accepts returns true if a key/value pair is accepted by the map's validator, if any. It is called
+// without holding the lock, except by RewriteValues
+func (m *BiMultiMap[K, V]) accepts(key K, value V) bool {
+	return m.validator == nil || m.validator(key, value) == nil
+}
+
+// addPairs adds key/value pairs that have already been validated under a single lock
+func (m *BiMultiMap[K, V]) addPairs(pairs []Pair[K, V]) {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	if m.ttl > 0 {
+		m.evictExpired()
+	}
+	for _, p := range pairs {
+		m.add(p.Key, p.Value)
+	}
+}
+
+// add adds a key/value pair and reports whether the map changed. The caller must hold the write lock
+func (m *BiMultiMap[K, V]) add(key K, value V) bool {
+	if m.ttl > 0 {
+		m.touch(key, value)
+	}
 
-	values = append(values, value)
-	m.forward[key] = values
+	// Value already exists for that key - early exit
+	if !m.multiset && m.pairCount[Pair[K, V]{Key: key, Value: value}] > 0 {
+		return false
+	}
+
+	m.insert(key, value)
+	return true
+}
+
+// insert adds a key/value pair without checking whether it already exists. The caller must hold the
+// write lock
+func (m *BiMultiMap[K, V]) insert(key K, value V) {
+	values, found := m.forward[key]
+	m.forward[key] = append(values, value)
+	if m.lazyInverse {
+		delete(m.inverse, value)
+	} else {
+		m.inverse[value] = append(m.inverse[value], key)
+	}
 
-	keys, found := m.inverse[value]
 	if !found {
-		keys = make([]K, 0, 1)
+		m.keyAdded(key)
+	}
+	m.pairAdded(key, value)
+
+	if m.keyCapacity > 0 {
+		m.evictOldest(key)
+	}
+}
+
+// SetKeyCapacity limits the number of values that can be associated with each key. When adding a
+// value to a key that is already at capacity, the value that was added to the key the longest time
+// ago is evicted, and keys that currently exceed the capacity have their oldest values evicted
+// immediately. A capacity of zero or less removes the limit
+func (m *BiMultiMap[K, V]) SetKeyCapacity(n int) {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	m.keyCapacity = max(n, 0)
+	if m.keyCapacity == 0 {
+		return
+	}
+
+	for k := range m.forward {
+		m.evictOldest(k)
+	}
+}
+
+// evictOldest deletes the oldest values of a key until it is within the key capacity. The caller
+// must hold the write lock
+func (m *BiMultiMap[K, V]) evictOldest(key K) {
+	for len(m.forward[key]) > m.keyCapacity {
+		m.deleteKeyValue(key, m.forward[key][0])
 	}
-	keys = append(keys, key)
-	m.inverse[value] = keys
 }
 
 // KeyExists returns true if a key exists in the map
 func (m *BiMultiMap[K, V]) KeyExists(key K) bool {
+	m.expire()
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
@@ -85,17 +383,130 @@ func (m *BiMultiMap[K, V]) KeyExists(key K) bool {
 
 // ValueExists returns true if a value exists in the map
 func (m *BiMultiMap[K, V]) ValueExists(value V) bool {
+	m.expire()
+
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	_, found := m.inverse[value]
-	return found
+	return len(m.keysOf(value)) > 0
+}
+
+// Contains returns true if a key/value pair exists in the map
+func (m *BiMultiMap[K, V]) Contains(key K, value V) bool {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.pairCount[Pair[K, V]{Key: key, Value: value}] > 0
+}
+
+// SortKeyValues sorts the values of a key in place according to less, so that later lookups return
+// them in that order. Since the values are then no longer in insertion order, it also changes which
+// values PairIndex reports and SetKeyCapacity evicts first
+func (m *BiMultiMap[K, V]) SortKeyValues(key K, less func(a, b V) bool) {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	slices.SortStableFunc(m.forward[key], func(a, b V) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+// KeyGeneration returns a counter that changes whenever a key is added to or removed from the map.
+// Unlike Version, it does not change when values are added to or removed from a key that stays in
+// the map, so it can be used to invalidate caches that only depend on the set of keys
+func (m *BiMultiMap[K, V]) KeyGeneration() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.keyGeneration
+}
+
+// SetKeyMeta attaches arbitrary metadata to a key, replacing any metadata it already had. The metadata
+// is discarded when the key is removed from the map. It does nothing if the key does not exist
+func (m *BiMultiMap[K, V]) SetKeyMeta(key K, meta any) {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	if _, found := m.forward[key]; !found {
+		return
+	}
+	if m.keyMeta == nil {
+		m.keyMeta = make(map[K]any)
+	}
+	m.keyMeta[key] = meta
+}
+
+// KeyMeta returns the metadata attached to a key with SetKeyMeta, and false if there is none
+func (m *BiMultiMap[K, V]) KeyMeta(key K) (any, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	meta, found := m.keyMeta[key]
+	return meta, found
+}
+
+// PairIndex returns the position of a value among the values associated with a key, or -1 if the
+// key/value pair does not exist. Values are kept in insertion order, so this is the number of values
+// that were added to the key before this one and are still present
+func (m *BiMultiMap[K, V]) PairIndex(key K, value V) int {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for i, v := range m.forward[key] {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// FirstValue returns the value that was associated with a key before any of its other values, and
+// false if the key does not exist
+func (m *BiMultiMap[K, V]) FirstValue(key K) (V, bool) {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	values := m.forward[key]
+	if len(values) == 0 {
+		var zero V
+		return zero, false
+	}
+	return values[0], true
+}
+
+// FirstKey returns the key that was associated with a value before any of its other keys, and false
+// if the value does not exist
+func (m *BiMultiMap[K, V]) FirstKey(value V) (K, bool) {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := m.keysOf(value)
+	if len(keys) == 0 {
+		var zero K
+		return zero, false
+	}
+	return keys[0], true
 }
 
 // DeleteKey deletes a key from the map and returns its associated values
 func (m *BiMultiMap[K, V]) DeleteKey(key K) []V {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	defer m.unlock()
 
 	values, found := m.forward[key]
 	if !found {
@@ -103,22 +514,65 @@ func (m *BiMultiMap[K, V]) DeleteKey(key K) []V {
 	}
 
 	delete(m.forward, key)
+	m.keyRemoved(key)
+	m.unlinkKey(key, values)
 
-	for _, v := range values {
-		newKeys := deleteElement(m.inverse[v], key)
-		m.inverse[v] = newKeys
+	return values
+}
+
+// ClearKey deletes all of the values of a key and returns them. By default the key is then removed
+// from the map, just like with DeleteKey. For maps created with NewRetainingEmptyKeys the key is kept
+// with no values, so that KeyExists still returns true for it
+func (m *BiMultiMap[K, V]) ClearKey(key K) []V {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	values, found := m.forward[key]
+	if !found {
+		return make([]V, 0)
+	}
+
+	if m.retainEmptyKeys {
+		m.forward[key] = make([]V, 0)
+	} else {
+		delete(m.forward, key)
+		m.keyRemoved(key)
 	}
+	m.unlinkKey(key, values)
 
 	return values
 }
 
+// unlinkKey removes a key from the inverse entries of the values it was associated with, after the
+// key's forward entry has been removed or cleared. The caller must hold the write lock
+func (m *BiMultiMap[K, V]) unlinkKey(key K, values []V) {
+	for _, v := range values {
+		if m.lazyInverse {
+			delete(m.inverse, v)
+			m.pairRemoved(key, v)
+			continue
+		}
+
+		newKeys := deleteElement(m.inverse[v], key)
+		if m.autoCompact {
+			newKeys = compactSlice(newKeys)
+		}
+		if len(newKeys) > 0 {
+			m.inverse[v] = newKeys
+		} else {
+			delete(m.inverse, v)
+		}
+		m.pairRemoved(key, v)
+	}
+}
+
 // DeleteValue deletes a value from the map and returns its associated keys
 func (m *BiMultiMap[K, V]) DeleteValue(value V) []K {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+	m.mutex.Lock()
+	defer m.unlock()
 
-	keys, found := m.inverse[value]
-	if !found {
+	keys := m.keysOf(value)
+	if len(keys) == 0 {
 		return make([]K, 0)
 	}
 
@@ -126,106 +580,1658 @@ func (m *BiMultiMap[K, V]) DeleteValue(value V) []K {
 
 	for _, k := range keys {
 		newVals := deleteElement(m.forward[k], value)
-		m.forward[k] = newVals
+		if m.autoCompact {
+			newVals = compactSlice(newVals)
+		}
+		if len(newVals) > 0 {
+			m.forward[k] = newVals
+		} else if _, found := m.forward[k]; found {
+			delete(m.forward, k)
+			m.keyRemoved(k)
+		}
+		m.pairRemoved(k, value)
 	}
 
 	return keys
 }
 
-// DeleteKeyValue deletes a single key/value pair
+// DeleteKeyValue deletes a single key/value pair. It takes time proportional to the number of values
+// of the key and the number of keys of the value, since the remaining elements are shifted to keep
+// them in insertion order
 func (m *BiMultiMap[K, V]) DeleteKeyValue(key K, value V) {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	defer m.unlock()
 
-	_, foundValue := m.forward[key]
-	_, foundKey := m.inverse[value]
+	m.deleteKeyValue(key, value)
+}
 
-	if foundKey && foundValue {
-		newVals := deleteElement(m.forward[key], value)
-		if len(newVals) > 0 {
-			m.forward[key] = newVals
-		} else {
-			delete(m.forward, key)
-		}
+// TakePair deletes a single key/value pair and returns true if it existed. When several goroutines
+// try to take the same pair concurrently, exactly one of them gets true
+func (m *BiMultiMap[K, V]) TakePair(key K, value V) bool {
+	m.mutex.Lock()
+	defer m.unlock()
 
-		newKeys := deleteElement(m.inverse[value], key)
-		if len(newKeys) > 0 {
-			m.inverse[value] = newKeys
-		} else {
-			delete(m.inverse, value)
+	return m.deleteKeyValue(key, value)
+}
+
+// RemoveValueFromKeys deletes the value from each of the given keys, leaving it associated with any
+// other keys. It returns the number of key/value pairs that were actually removed
+func (m *BiMultiMap[K, V]) RemoveValueFromKeys(value V, keys ...K) int {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	removed := 0
+	for _, k := range keys {
+		if m.deleteKeyValue(k, value) {
+			removed++
 		}
 	}
+	return removed
 }
 
-// Merge merges two BiMultiMap[K, V]s: returns a new BiMultiMap consisting of all the key/value pairs in
-// this one and all key/value pairs in the other one
-func (m *BiMultiMap[K, V]) Merge(other *BiMultiMap[K, V]) *BiMultiMap[K, V] {
-	m.mutex.RLock()
-	other.mutex.RLock()
-	defer func() {
-		other.mutex.RUnlock()
-		m.mutex.RUnlock()
-	}()
+// RenameKeys renames each key in the mapping to its corresponding new key, and returns the number of
+// keys that were renamed. If a new key already exists, the values are merged without duplicates. All
+// renames happen at once: every old key is removed before any of the new keys are added, so a
+// mapping can swap keys or chain renames (e.g. a to b and b to c) without either key's values being
+// affected by the other rename
+func (m *BiMultiMap[K, V]) RenameKeys(mapping map[K]K) int {
+	m.mutex.Lock()
+	defer m.unlock()
 
-	res := New[K, V]()
+	type rename struct {
+		key    K
+		values []V
+	}
 
-	for _, k := range m.Keys() {
-		for _, v := range m.LookupKey(k) {
-			res.Add(k, v)
+	renames := make([]rename, 0, len(mapping))
+	for oldKey, newKey := range mapping {
+		values, found := m.forward[oldKey]
+		if !found || oldKey == newKey {
+			continue
 		}
-	}
 
-	for _, k := range other.Keys() {
-		for _, v := range other.LookupKey(k) {
-			res.Add(k, v)
+		values = slices.Clone(values)
+		for _, v := range values {
+			m.deleteKeyValue(oldKey, v)
 		}
+		renames = append(renames, rename{key: newKey, values: values})
 	}
 
-	return res
+	for _, r := range renames {
+		for _, v := range r.values {
+			m.add(r.key, v)
+		}
+	}
+	return len(renames)
 }
 
-// Clear clears all entries in the BiMultiMap[K, V]
-func (m *BiMultiMap[K, V]) Clear() {
+// CoalesceValues merges the value drop into the value keep: every key associated with drop becomes
+// associated with keep instead (without duplicates), and drop is removed from the map. It returns
+// false if drop does not exist
+func (m *BiMultiMap[K, V]) CoalesceValues(keep, drop V) bool {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	defer m.unlock()
 
-	m.forward = make(map[K][]V)
-	m.inverse = make(map[V][]K)
+	keys := m.keysOf(drop)
+	if len(keys) == 0 {
+		return false
+	}
+	if keep == drop {
+		return true
+	}
+
+	for _, k := range slices.Clone(keys) {
+		m.deleteKeyValue(k, drop)
+		m.add(k, keep)
+	}
+	return true
 }
 
-// Keys returns an unordered slice containing all of the map's keys
-func (m *BiMultiMap[K, V]) Keys() []K {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+// ReplaceValueEverywhere replaces oldValue with newValue in the values of every key, without adding
+// duplicates to keys that already have newValue, and returns the number of keys that were affected.
+// Unlike CoalesceValues, newValue does not need to exist. Nothing is replaced if both values are equal.
+// Keys for which the validator of a map created with NewWithValidator rejects newValue keep oldValue
+// and are not counted
+func (m *BiMultiMap[K, V]) ReplaceValueEverywhere(oldValue, newValue V) int {
+	if oldValue == newValue {
+		return 0
+	}
 
-	keys := make([]K, 0, len(m.forward))
-	for k := range m.forward {
-		keys = append(keys, k)
+	// The validator must be called without holding the lock, so the keys are checked beforehand and
+	// any key that gets oldValue in the meantime is left alone
+	var accepted map[K]bool
+	if m.validator != nil {
+		m.mutex.RLock()
+		keys := slices.Clone(m.keysOf(oldValue))
+		m.mutex.RUnlock()
+
+		accepted = make(map[K]bool, len(keys))
+		for _, k := range keys {
+			accepted[k] = m.accepts(k, newValue)
+		}
 	}
-	return keys
+
+	m.mutex.Lock()
+	defer m.unlock()
+
+	keys := slices.DeleteFunc(slices.Clone(m.keysOf(oldValue)), func(k K) bool {
+		return accepted != nil && !accepted[k]
+	})
+	for _, k := range keys {
+		m.deleteKeyValue(k, oldValue)
+		m.add(k, newValue)
+	}
+	return len(uniqueElements(keys))
 }
 
-// Values returns an unordered slice containing all of the map's values
-func (m *BiMultiMap[K, V]) Values() []V {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+// CoalesceKeys merges the key drop into the key keep: every value associated with drop becomes
+// associated with keep instead (without duplicates), and drop is removed from the map. It returns
+// false if drop does not exist
+func (m *BiMultiMap[K, V]) CoalesceKeys(keep, drop K) bool {
+	m.mutex.Lock()
+	defer m.unlock()
 
-	values := make([]V, 0, len(m.inverse))
-	for v := range m.inverse {
-		values = append(values, v)
+	values, found := m.forward[drop]
+	if !found {
+		return false
 	}
-	return values
+	if keep == drop {
+		return true
+	}
+
+	for _, v := range slices.Clone(values) {
+		m.deleteKeyValue(drop, v)
+		m.add(keep, v)
+	}
+	return true
 }
 
-// Helper function: delete an element from a slice if it exists
-func deleteElement[T comparable](slice []T, element T) []T {
-	newSlice := make([]T, 0, len(slice)-1)
+// RewriteValues replaces the values of every key with the result of calling fn with the key and a
+// copy of its values, keeping the inverse consistent. This allows filtering, sorting or deduplicating
+// the values of each key in a single pass. The values are stored in the order fn returns them, but
+// duplicates are dropped unless the map was created with NewMultiset, and a key for which fn returns
+// no values is removed. fn is called with the write lock held, so it must not access the map. New
+// values rejected by the validator of a map created with NewWithValidator are dropped. Since they are
+// only known while holding the write lock, the validator is called with the lock held here
+func (m *BiMultiMap[K, V]) RewriteValues(fn func(K, []V) []V) {
+	m.mutex.Lock()
+	defer m.unlock()
 
-	for _, val := range slice {
-		if val != element {
-			newSlice = append(newSlice, val)
-		}
+	keys := make([]K, 0, len(m.forward))
+	for k := range m.forward {
+		keys = append(keys, k)
 	}
 
-	return newSlice
+	for _, k := range keys {
+		newVals := fn(k, slices.Clone(m.forward[k]))
+		if m.validator != nil {
+			newVals = slices.DeleteFunc(slices.Clone(newVals), func(v V) bool {
+				return m.pairCount[Pair[K, V]{Key: k, Value: v}] == 0 && !m.accepts(k, v)
+			})
+		}
+		if !m.multiset {
+			newVals = uniqueElements(newVals)
+		}
+
+		// Work out how many occurrences of each value have to be added or removed
+		delta := make(map[V]int)
+		for _, v := range m.forward[k] {
+			delta[v]--
+		}
+		for _, v := range newVals {
+			delta[v]++
+		}
+		for v, d := range delta {
+			for ; d < 0; d++ {
+				m.deleteKeyValue(k, v)
+			}
+			for ; d > 0; d-- {
+				m.add(k, v)
+			}
+		}
+
+		if values, found := m.forward[k]; found && len(values) == len(newVals) {
+			copy(values, newVals)
+		}
+	}
+}
+
+// Upsert sets the values of a key to exactly the given values, in the given order and without
+// duplicates, creating the key if it does not exist or removing it if values is empty. Values rejected
+// by the validator of a map created with NewWithValidator are left out as if they had not been given.
+// It returns the values that were added to the key and the values that were removed from it
+func (m *BiMultiMap[K, V]) Upsert(key K, values []V) (added, removed []V) {
+	if m.validator != nil {
+		values = slices.DeleteFunc(slices.Clone(values), func(v V) bool {
+			return !m.accepts(key, v)
+		})
+	}
+
+	m.mutex.Lock()
+	defer m.unlock()
+
+	newVals := uniqueElements(values)
+	oldVals := uniqueElements(m.forward[key])
+	added = make([]V, 0)
+	removed = make([]V, 0)
+
+	// Work out how many occurrences of each value have to be added or removed. Values are only
+	// repeated in maps created with NewMultiset, where the extra occurrences are removed
+	delta := make(map[V]int)
+	for _, v := range m.forward[key] {
+		delta[v]--
+	}
+	for _, v := range newVals {
+		delta[v]++
+	}
+	for _, v := range oldVals {
+		if !containsElement(newVals, v) {
+			removed = append(removed, v)
+		}
+		for d := delta[v]; d < 0; d++ {
+			m.deleteKeyValue(key, v)
+		}
+	}
+	for _, v := range newVals {
+		if delta[v] > 0 {
+			added = append(added, v)
+			m.add(key, v)
+		}
+	}
+
+	if current, found := m.forward[key]; found && len(current) == len(newVals) {
+		copy(current, newVals)
+	}
+	return added, removed
+}
+
+// DedupSlices repairs the map by removing duplicate entries from the values of every key and the keys
+// of every value, and returns the number of duplicates removed. Duplicates should never happen, so
+// this is only useful to recover from bugs. It does nothing for maps created with NewMultiset, where
+// duplicates are intentional
+func (m *BiMultiMap[K, V]) DedupSlices() int {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	if m.multiset {
+		return 0
+	}
+
+	removed := 0
+	for k, values := range m.forward {
+		unique := uniqueElements(values)
+		if len(unique) != len(values) {
+			removed += len(values) - len(unique)
+			m.forward[k] = unique
+		}
+	}
+	if m.lazyInverse {
+		// The cached keys were built from the forward index and may contain the same duplicates
+		clear(m.inverse)
+		return removed
+	}
+	for v, keys := range m.inverse {
+		unique := uniqueElements(keys)
+		if len(unique) != len(keys) {
+			removed += len(keys) - len(unique)
+			m.inverse[v] = unique
+		}
+	}
+	return removed
+}
+
+// deleteKeyValue deletes a single key/value pair, removing the key and the value from the map if
+// they are left without any associations, and reports whether the pair existed. The caller must
+// hold the write lock
+func (m *BiMultiMap[K, V]) deleteKeyValue(key K, value V) bool {
+	if m.pairCount[Pair[K, V]{Key: key, Value: value}] == 0 {
+		return false
+	}
+	values := m.forward[key]
+
+	// Only one occurrence is removed, which makes a difference for multisets
+	newVals := deleteFirstElement(values, value)
+	if m.autoCompact {
+		newVals = compactSlice(newVals)
+	}
+	if len(newVals) > 0 {
+		m.forward[key] = newVals
+	} else {
+		delete(m.forward, key)
+		m.keyRemoved(key)
+	}
+
+	if m.lazyInverse {
+		delete(m.inverse, value)
+	} else {
+		newKeys := deleteFirstElement(m.inverse[value], key)
+		if m.autoCompact {
+			newKeys = compactSlice(newKeys)
+		}
+		if len(newKeys) > 0 {
+			m.inverse[value] = newKeys
+		} else {
+			delete(m.inverse, value)
+		}
+	}
+
+	m.pairRemoved(key, value)
+	return true
+}
+
+// keyAdded updates the bookkeeping after a key has been added. The caller must hold the write lock
+func (m *BiMultiMap[K, V]) keyAdded(key K) {
+	m.keyGeneration++
+
+	if m.ordered {
+		m.sequence++
+		m.keyOrder[key] = m.sequence
+	}
+}
+
+// keyRemoved updates the bookkeeping after a key has been removed. The caller must hold the write
+// lock
+func (m *BiMultiMap[K, V]) keyRemoved(key K) {
+	m.keyGeneration++
+
+	if m.ordered {
+		delete(m.keyOrder, key)
+	}
+	delete(m.keyMeta, key)
+}
+
+// pairAdded updates the bookkeeping after a key/value pair has been added to both indexes. The
+// caller must hold the write lock
+func (m *BiMultiMap[K, V]) pairAdded(key K, value V) {
+	m.recordChange(PairAdded, key, value)
+	m.notify(PairAdded, key, value)
+	m.keyModified(key)
+
+	p := Pair[K, V]{Key: key, Value: value}
+	m.pairCount[p]++
+	if m.ordered {
+		if _, found := m.pairOrder[p]; !found {
+			m.sequence++
+			m.pairOrder[p] = m.sequence
+		}
+	}
+}
+
+// pairRemoved updates the bookkeeping after an occurrence of a key/value pair has been removed from
+// both indexes. The caller must hold the write lock
+func (m *BiMultiMap[K, V]) pairRemoved(key K, value V) {
+	m.recordChange(PairRemoved, key, value)
+	m.notify(PairRemoved, key, value)
+	m.keyModified(key)
+
+	p := Pair[K, V]{Key: key, Value: value}
+	if m.pairCount[p] > 1 {
+		m.pairCount[p]--
+		return
+	}
+	delete(m.pairCount, p)
+	if m.ordered {
+		delete(m.pairOrder, p)
+	}
+}
+
+// Clone returns an independent deep copy of the map, so that changes to either map never affect the
+// other. The copy is created in the same mode as this map (see NewMultiset, NewOrdered, NewWithTTL
+// etc.) and keeps its key capacity, validator and key metadata, but it has no subscribers and its
+// change history starts empty
+func (m *BiMultiMap[K, V]) Clone() *BiMultiMap[K, V] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := &BiMultiMap[K, V]{
+		forward:         cloneIndex(m.forward),
+		pairCount:       maps.Clone(m.pairCount),
+		multiset:        m.multiset,
+		autoCompact:     m.autoCompact,
+		ordered:         m.ordered,
+		sequence:        m.sequence,
+		keyOrder:        maps.Clone(m.keyOrder),
+		pairOrder:       maps.Clone(m.pairOrder),
+		retainEmptyKeys: m.retainEmptyKeys,
+		validator:       m.validator,
+		keyCapacity:     m.keyCapacity,
+		ttl:             m.ttl,
+		now:             m.now,
+		expiries:        slices.Clone(m.expiries),
+		modifiedAt:      maps.Clone(m.modifiedAt),
+		keyMeta:         maps.Clone(m.keyMeta),
+		lazyInverse:     m.lazyInverse,
+	}
+
+	if m.lazyInverse {
+		res.inverse = make(map[V][]K)
+	} else {
+		res.inverse = cloneIndex(m.inverse)
+	}
+
+	if m.addedAt != nil {
+		res.addedAt = make(map[K]map[V]time.Time, len(m.addedAt))
+		for k, added := range m.addedAt {
+			res.addedAt[k] = maps.Clone(added)
+		}
+	}
+	return res
+}
+
+// Remap returns a new BiMultiMap built from the pairs returned by calling fn with every key and a copy
+// of its values, which allows keys to be split, merged or renamed. Duplicate pairs are only added
+// once. fn is called with the read lock held, so it must not modify the map
+func (m *BiMultiMap[K, V]) Remap(fn func(K, []V) []Pair[K, V]) *BiMultiMap[K, V] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := New[K, V]()
+	for k, values := range m.forward {
+		for _, p := range fn(k, slices.Clone(values)) {
+			res.add(p.Key, p.Value)
+		}
+	}
+	return res
+}
+
+// Merge merges two BiMultiMap[K, V]s: returns a new BiMultiMap consisting of all the key/value pairs in
+// this one and all key/value pairs in the other one
+func (m *BiMultiMap[K, V]) Merge(other *BiMultiMap[K, V]) *BiMultiMap[K, V] {
+	m.expire()
+	other.expire()
+
+	unlock := m.rlockBoth(other)
+	defer unlock()
+
+	res := New[K, V]()
+	for k, values := range m.forward {
+		for _, v := range values {
+			res.add(k, v)
+		}
+	}
+	for k, values := range other.forward {
+		for _, v := range values {
+			res.add(k, v)
+		}
+	}
+	return res
+}
+
+// MergeIntoReturningAdded adds all of the key/value pairs in other to this map, and returns the pairs
+// that were not already in it. other is read-locked while its pairs are copied, and is not modified.
+// Pairs rejected by the validator of a map created with NewWithValidator are skipped and not returned
+func (m *BiMultiMap[K, V]) MergeIntoReturningAdded(other *BiMultiMap[K, V]) []Pair[K, V] {
+	other.mutex.RLock()
+	pairs := other.pairs()
+	other.mutex.RUnlock()
+
+	pairs = slices.DeleteFunc(pairs, func(p Pair[K, V]) bool {
+		return !m.accepts(p.Key, p.Value)
+	})
+
+	m.mutex.Lock()
+	defer m.unlock()
+
+	added := make([]Pair[K, V], 0)
+	for _, p := range pairs {
+		if m.add(p.Key, p.Value) {
+			added = append(added, p)
+		}
+	}
+	return added
+}
+
+// Overlay returns a new BiMultiMap where the values of every key in top replace the values of that key
+// in this map, and keys that are only in this map keep their values. Unlike Merge, the values of keys
+// present in both maps are not combined
+func (m *BiMultiMap[K, V]) Overlay(top *BiMultiMap[K, V]) *BiMultiMap[K, V] {
+	unlock := m.rlockBoth(top)
+	defer unlock()
+
+	res := New[K, V]()
+	for k, values := range m.forward {
+		if _, found := top.forward[k]; found {
+			continue
+		}
+		for _, v := range values {
+			res.add(k, v)
+		}
+	}
+	for k, values := range top.forward {
+		for _, v := range values {
+			res.add(k, v)
+		}
+	}
+	return res
+}
+
+// SymmetricDifference returns a new BiMultiMap containing the key/value pairs that are in exactly one
+// of this map and the other map
+func (m *BiMultiMap[K, V]) SymmetricDifference(other *BiMultiMap[K, V]) *BiMultiMap[K, V] {
+	unlock := m.rlockBoth(other)
+	defer unlock()
+
+	res := New[K, V]()
+	for k, values := range m.forward {
+		for _, v := range values {
+			if other.pairCount[Pair[K, V]{Key: k, Value: v}] == 0 {
+				res.add(k, v)
+			}
+		}
+	}
+	for k, values := range other.forward {
+		for _, v := range values {
+			if m.pairCount[Pair[K, V]{Key: k, Value: v}] == 0 {
+				res.add(k, v)
+			}
+		}
+	}
+	return res
+}
+
+// MergeAll returns a new BiMultiMap containing all of the key/value pairs in all of the given maps,
+// without duplicates. Each map is read-locked while its pairs are copied. With no arguments it
+// returns a new, empty map
+func MergeAll[K comparable, V comparable](maps ...*BiMultiMap[K, V]) *BiMultiMap[K, V] {
+	res := New[K, V]()
+	seen := make(map[Pair[K, V]]struct{})
+
+	for _, m := range maps {
+		m.mutex.RLock()
+		for k, values := range m.forward {
+			for _, v := range values {
+				p := Pair[K, V]{Key: k, Value: v}
+				if _, found := seen[p]; !found {
+					seen[p] = struct{}{}
+					res.insert(k, v)
+				}
+			}
+		}
+		m.mutex.RUnlock()
+	}
+
+	return res
+}
+
+// MergeTracked returns a new BiMultiMap containing all of the key/value pairs in all of the given
+// named maps, without duplicates, together with the sorted names of the maps that contain each pair.
+// Each map is read-locked while its pairs are copied
+func MergeTracked[K comparable, V comparable](sources map[string]*BiMultiMap[K, V]) (*BiMultiMap[K, V], map[Pair[K, V]][]string) {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	res := New[K, V]()
+	provenance := make(map[Pair[K, V]][]string)
+	for _, name := range names {
+		m := sources[name]
+		m.mutex.RLock()
+		for k, values := range m.forward {
+			for _, v := range values {
+				p := Pair[K, V]{Key: k, Value: v}
+				found := provenance[p]
+				if len(found) == 0 {
+					res.insert(k, v)
+				} else if found[len(found)-1] == name {
+					// Duplicate pair in a map created with NewMultiset
+					continue
+				}
+				provenance[p] = append(found, name)
+			}
+		}
+		m.mutex.RUnlock()
+	}
+
+	return res, provenance
+}
+
+// MergeValuesWith returns a new BiMultiMap containing the keys of both maps. Keys that are only in one
+// of the maps keep their values, and the values of keys that are in both are the result of calling
+// combine with a copy of the values in a and a copy of the values in b. Duplicates returned by combine
+// are dropped, and a key for which combine returns no values is left out. combine is called with the
+// read locks of both maps held, so it must not modify them
+func MergeValuesWith[K comparable, V comparable](a, b *BiMultiMap[K, V], combine func(existing, incoming []V) []V) *BiMultiMap[K, V] {
+	unlock := a.rlockBoth(b)
+	defer unlock()
+
+	res := New[K, V]()
+	for k, values := range a.forward {
+		if incoming, found := b.forward[k]; found {
+			values = combine(slices.Clone(values), slices.Clone(incoming))
+		}
+		for _, v := range values {
+			res.add(k, v)
+		}
+	}
+	for k, values := range b.forward {
+		if _, found := a.forward[k]; found {
+			continue
+		}
+		for _, v := range values {
+			res.add(k, v)
+		}
+	}
+	return res
+}
+
+// Clear clears all entries in the BiMultiMap[K, V]
+func (m *BiMultiMap[K, V]) Clear() {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	m.reset()
+}
+
+// reset removes all entries from the map. The caller must hold the write lock
+func (m *BiMultiMap[K, V]) reset() {
+	if len(m.forward) > 0 {
+		m.keyGeneration++
+	}
+
+	if len(m.subscribers) > 0 {
+		for _, p := range m.pairs() {
+			m.notify(PairRemoved, p.Key, p.Value)
+		}
+	}
+
+	m.forward = make(map[K][]V)
+	m.inverse = make(map[V][]K)
+	m.pairCount = make(map[Pair[K, V]]int)
+	m.resetChanges()
+	m.keyMeta = nil
+
+	if m.modifiedAt != nil {
+		m.modifiedAt = make(map[K]time.Time)
+	}
+
+	if m.ordered {
+		m.keyOrder = make(map[K]uint64)
+		m.pairOrder = make(map[Pair[K, V]]uint64)
+	}
+
+	if m.ttl > 0 {
+		m.addedAt = make(map[K]map[V]time.Time)
+		m.expiries = nil
+	}
+}
+
+// Keys returns an unordered slice containing all of the map's keys. The slice is a snapshot taken
+// under the read lock, so it reflects the map at the time of the call and can be iterated safely while
+// other goroutines modify the map
+func (m *BiMultiMap[K, V]) Keys() []K {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := make([]K, 0, len(m.forward))
+	for k := range m.forward {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Values returns an unordered slice containing all of the map's values. The slice is a snapshot taken
+// under the read lock, so it reflects the map at the time of the call and can be iterated safely while
+// other goroutines modify the map
+func (m *BiMultiMap[K, V]) Values() []V {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	inverse := m.inverseIndex()
+	values := make([]V, 0, len(inverse))
+	for v := range inverse {
+		values = append(values, v)
+	}
+	return values
+}
+
+// NumKeys returns the number of keys in the map
+func (m *BiMultiMap[K, V]) NumKeys() int {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.forward)
+}
+
+// NumValues returns the number of distinct values in the map
+func (m *BiMultiMap[K, V]) NumValues() int {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.inverseIndex())
+}
+
+// Size returns the number of distinct key/value pairs in the map. For maps created with NewMultiset,
+// each pair is counted once no matter how many times it was added, just like Pairs yields it once
+func (m *BiMultiMap[K, V]) Size() int {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.pairCount)
+}
+
+// KeySet returns a newly allocated set containing all of the map's keys
+func (m *BiMultiMap[K, V]) KeySet() map[K]struct{} {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := make(map[K]struct{}, len(m.forward))
+	for k := range m.forward {
+		keys[k] = struct{}{}
+	}
+	return keys
+}
+
+// ValueSet returns a newly allocated set containing all of the map's values
+func (m *BiMultiMap[K, V]) ValueSet() map[V]struct{} {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	inverse := m.inverseIndex()
+	values := make(map[V]struct{}, len(inverse))
+	for v := range inverse {
+		values[v] = struct{}{}
+	}
+	return values
+}
+
+// GroupedByValue returns a sequence that yields each value once together with a copy of its keys.
+// The sequence iterates over a snapshot taken when GroupedByValue is called, so later changes to the
+// map are not reflected in it
+func (m *BiMultiMap[K, V]) GroupedByValue() iter.Seq2[V, []K] {
+	m.mutex.RLock()
+	inverse := m.inverseIndex()
+	values := make([]V, 0, len(inverse))
+	keys := make([][]K, 0, len(inverse))
+	for v, k := range inverse {
+		values = append(values, v)
+		keys = append(keys, slices.Clone(k))
+	}
+	m.mutex.RUnlock()
+
+	return func(yield func(V, []K) bool) {
+		for i, v := range values {
+			if !yield(v, keys[i]) {
+				return
+			}
+		}
+	}
+}
+
+// EntriesInKeyRange returns a sequence that yields, in key order, each key k of a map with string keys
+// such that lo <= k < hi, together with a copy of its values. The sequence iterates over a snapshot
+// taken when EntriesInKeyRange is called, so later changes to the map are not reflected in it. This
+// is a function rather than a method because it only applies to maps with string keys
+func EntriesInKeyRange[V comparable](m *BiMultiMap[string, V], lo, hi string) iter.Seq2[string, []V] {
+	m.mutex.RLock()
+	keys := make([]string, 0)
+	for k := range m.forward {
+		if lo <= k && k < hi {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	values := make([][]V, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, slices.Clone(m.forward[k]))
+	}
+	m.mutex.RUnlock()
+
+	return func(yield func(string, []V) bool) {
+		for i, k := range keys {
+			if !yield(k, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Batches returns a sequence that yields all of the map's key/value pairs in slices of at most size
+// pairs. The sequence iterates over a snapshot taken when Batches is called, so later changes to the
+// map are not reflected in it. It panics if size is less than 1
+func (m *BiMultiMap[K, V]) Batches(size int) iter.Seq[[]Pair[K, V]] {
+	m.mutex.RLock()
+	pairs := m.pairs()
+	m.mutex.RUnlock()
+
+	return slices.Chunk(pairs, size)
+}
+
+// Pairs returns a sequence that yields each distinct key/value pair of the map exactly once, in no
+// particular order. The sequence iterates over a snapshot taken under the read lock when Pairs is
+// called, so later changes to the map are not reflected in it
+func (m *BiMultiMap[K, V]) Pairs() iter.Seq2[K, V] {
+	m.expire()
+
+	m.mutex.RLock()
+	pairs := m.pairs()
+	m.mutex.RUnlock()
+
+	if m.multiset {
+		pairs = uniqueElements(pairs)
+	}
+
+	return func(yield func(K, V) bool) {
+		for _, p := range pairs {
+			if !yield(p.Key, p.Value) {
+				return
+			}
+		}
+	}
+}
+
+// Walk calls fn for each of the map's key/value pairs, in no particular order, until fn returns false.
+// It iterates over a snapshot taken when Walk is called, so fn can safely access or modify the map
+func (m *BiMultiMap[K, V]) Walk(fn func(K, V) bool) {
+	m.mutex.RLock()
+	pairs := m.pairs()
+	m.mutex.RUnlock()
+
+	for _, p := range pairs {
+		if !fn(p.Key, p.Value) {
+			return
+		}
+	}
+}
+
+// pairs returns an unordered slice containing all of the map's key/value pairs. The caller must hold
+// the lock
+func (m *BiMultiMap[K, V]) pairs() []Pair[K, V] {
+	res := make([]Pair[K, V], 0)
+	for k, values := range m.forward {
+		for _, v := range values {
+			res = append(res, Pair[K, V]{Key: k, Value: v})
+		}
+	}
+	return res
+}
+
+// Canonical returns a canonical string representation of the map, suitable for hashing or content
+// addressing: two maps with the same key/value pairs always produce the same string. Each pair is
+// formatted on its own line using fmt's Go-syntax representation, and the lines are sorted
+func (m *BiMultiMap[K, V]) Canonical() string {
+	m.mutex.RLock()
+	lines := make([]string, 0)
+	for k, values := range m.forward {
+		for _, v := range values {
+			lines = append(lines, fmt.Sprintf("%#v: %#v\n", k, v))
+		}
+	}
+	m.mutex.RUnlock()
+
+	slices.Sort(lines)
+	return strings.Join(lines, "")
+}
+
+// PartitionPairs splits the map's key/value pairs in a single pass into those for which pred returns
+// true and those for which it returns false, in no particular order. pred is called with the read
+// lock held, so it must not modify the map
+func (m *BiMultiMap[K, V]) PartitionPairs(pred func(K, V) bool) (matched, unmatched []Pair[K, V]) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	matched = make([]Pair[K, V], 0)
+	unmatched = make([]Pair[K, V], 0)
+	for k, values := range m.forward {
+		for _, v := range values {
+			if pred(k, v) {
+				matched = append(matched, Pair[K, V]{Key: k, Value: v})
+			} else {
+				unmatched = append(unmatched, Pair[K, V]{Key: k, Value: v})
+			}
+		}
+	}
+	return matched, unmatched
+}
+
+// Reduce folds fn over every key/value pair of a map, in no particular order, starting from init and
+// returning the final accumulator. fn is called with the read lock held, so it must not modify the
+// map. This is a function rather than a method because Go methods cannot have their own type
+// parameters
+func Reduce[K comparable, V comparable, A any](m *BiMultiMap[K, V], init A, fn func(acc A, k K, v V) A) A {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	acc := init
+	for k, values := range m.forward {
+		for _, v := range values {
+			acc = fn(acc, k, v)
+		}
+	}
+	return acc
+}
+
+// EstimatedBytes returns an approximate in-memory size of the map in bytes. It is only an estimate:
+// it is computed from the number of entries, the sizes of K and V and the capacity of the stored
+// slices, plus a heuristic per-entry map overhead, and does not follow pointers inside K or V
+func (m *BiMultiMap[K, V]) EstimatedBytes() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var key K
+	var value V
+	keySize := int(unsafe.Sizeof(key))
+	valueSize := int(unsafe.Sizeof(value))
+	sliceHeaderSize := int(unsafe.Sizeof([]V(nil)))
+
+	size := int(unsafe.Sizeof(*m))
+	size += len(m.pairCount) * (keySize + valueSize + int(unsafe.Sizeof(0)) + mapEntryOverhead)
+	for _, values := range m.forward {
+		size += keySize + sliceHeaderSize + mapEntryOverhead + cap(values)*valueSize
+	}
+	m.inverseMutex.Lock()
+	defer m.inverseMutex.Unlock()
+	for _, keys := range m.inverse {
+		size += valueSize + sliceHeaderSize + mapEntryOverhead + cap(keys)*keySize
+	}
+	return size
+}
+
+// SliceStats returns the number of slices in the forward and inverse indexes and the sum of their
+// capacities. Since deletions keep the capacity of the slices (unless the map was created with
+// NewAutoCompacting), this helps diagnose maps that hold on to more memory than they need
+func (m *BiMultiMap[K, V]) SliceStats() (forwardSlices, inverseSlices, totalForwardCap, totalInverseCap int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.sliceStats()
+}
+
+// sliceStats implements SliceStats. The caller must hold the read or the write lock
+func (m *BiMultiMap[K, V]) sliceStats() (forwardSlices, inverseSlices, totalForwardCap, totalInverseCap int) {
+	for _, values := range m.forward {
+		totalForwardCap += cap(values)
+	}
+	m.inverseMutex.Lock()
+	defer m.inverseMutex.Unlock()
+	for _, keys := range m.inverse {
+		totalInverseCap += cap(keys)
+	}
+	return len(m.forward), len(m.inverse), totalForwardCap, totalInverseCap
+}
+
+// CompactAndReport reallocates every slice in the map that has unused capacity so that it holds
+// exactly its elements, and returns an approximation of the number of bytes of capacity that were
+// released, based on the sizes of K and V. The memory is only reclaimed once the garbage collector
+// frees the old slices
+func (m *BiMultiMap[K, V]) CompactAndReport() int {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	_, _, forwardBefore, inverseBefore := m.sliceStats()
+	for k, values := range m.forward {
+		if compacted := slices.Clone(values); cap(compacted) < cap(values) {
+			m.forward[k] = compacted
+		}
+	}
+	for v, keys := range m.inverse {
+		if compacted := slices.Clone(keys); cap(compacted) < cap(keys) {
+			m.inverse[v] = compacted
+		}
+	}
+	_, _, forwardAfter, inverseAfter := m.sliceStats()
+
+	var key K
+	var value V
+	return (forwardBefore-forwardAfter)*int(unsafe.Sizeof(value)) + (inverseBefore-inverseAfter)*int(unsafe.Sizeof(key))
+}
+
+// KeyEquivalenceClasses groups the keys into classes of keys that have exactly the same set of
+// values. Every key belongs to exactly one class, so keys with a unique value set form a class of
+// their own. Neither the classes nor the keys inside them are ordered. For maps created with
+// NewMultiset, how many times each value was added is ignored
+func (m *BiMultiMap[K, V]) KeyEquivalenceClasses() [][]K {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	// Keys are bucketed by a fingerprint of their value set. Fingerprints may collide, so each bucket
+	// can hold several classes which are told apart by comparing the actual value sets
+	buckets := make(map[string][][]K)
+	for key, values := range m.forward {
+		fp := fingerprint(uniqueElements(values))
+		classes := buckets[fp]
+		found := false
+		for i, class := range classes {
+			if sameElements(m.forward[class[0]], values) {
+				classes[i] = append(class, key)
+				found = true
+				break
+			}
+		}
+		if !found {
+			buckets[fp] = append(classes, []K{key})
+		}
+	}
+
+	res := make([][]K, 0, len(buckets))
+	for _, classes := range buckets {
+		res = append(res, classes...)
+	}
+	return res
+}
+
+// KeysByDegree groups the keys by their degree, i.e. the number of values associated with them.
+// The keys in each group are unordered
+func (m *BiMultiMap[K, V]) KeysByDegree() map[int][]K {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make(map[int][]K)
+	for k, values := range m.forward {
+		res[len(values)] = append(res[len(values)], k)
+	}
+	return res
+}
+
+// KeySummary returns a newly allocated map from each key to the number of values associated with it.
+// It is cheaper than copying the values when only the degrees are needed, e.g. for monitoring
+func (m *BiMultiMap[K, V]) KeySummary() map[K]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make(map[K]int, len(m.forward))
+	for k, values := range m.forward {
+		res[k] = len(values)
+	}
+	return res
+}
+
+// WithKeyDegreeBetween returns a new BiMultiMap containing only the keys whose degree, i.e. the number
+// of values associated with them, is between lo and hi inclusive, together with their values
+func (m *BiMultiMap[K, V]) WithKeyDegreeBetween(lo, hi int) *BiMultiMap[K, V] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := New[K, V]()
+	for k, values := range m.forward {
+		if len(values) < lo || len(values) > hi {
+			continue
+		}
+		for _, v := range values {
+			res.add(k, v)
+		}
+	}
+	return res
+}
+
+// KeySimilarity returns the Jaccard index of the value sets of two keys, i.e. the size of their
+// intersection divided by the size of their union. It returns 0 if either key does not exist
+func (m *BiMultiMap[K, V]) KeySimilarity(k1, k2 K) float64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	values1, found1 := m.forward[k1]
+	values2, found2 := m.forward[k2]
+	if !found1 || !found2 {
+		return 0
+	}
+
+	union := make(map[V]bool, len(values1)+len(values2))
+	for _, v := range values1 {
+		union[v] = false
+	}
+	intersection := 0
+	for _, v := range values2 {
+		inFirst, found := union[v]
+		if found && !inFirst {
+			// Mark the value so that duplicates in values2 are only counted once
+			union[v] = true
+			intersection++
+		} else if !found {
+			union[v] = false
+		}
+	}
+
+	if len(union) == 0 {
+		return 0
+	}
+	return float64(intersection) / float64(len(union))
+}
+
+// ValueCoOccurrence returns, for every unordered pair of distinct values, the number of keys that are
+// associated with both. Pairs of values that never occur together are omitted. Each pair appears in
+// the result only once, with the value whose fmt.Sprint representation sorts first as the Key, so
+// the count for a and b is found under Pair{a, b} if a sorts before b
+func (m *BiMultiMap[K, V]) ValueCoOccurrence() map[Pair[V, V]]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	labels := make(map[V]string)
+	label := func(v V) string {
+		if l, found := labels[v]; found {
+			return l
+		}
+		labels[v] = fmt.Sprint(v)
+		return labels[v]
+	}
+
+	res := make(map[Pair[V, V]]int)
+	for _, values := range m.forward {
+		unique := uniqueElements(values)
+		for i, a := range unique {
+			for _, b := range unique[i+1:] {
+				p := Pair[V, V]{Key: a, Value: b}
+				switch c := cmp.Compare(label(a), label(b)); {
+				case c > 0:
+					p = Pair[V, V]{Key: b, Value: a}
+				case c == 0:
+					// Distinct values with the same representation keep the order they were first seen in
+					if reversed := (Pair[V, V]{Key: b, Value: a}); res[reversed] > 0 {
+						p = reversed
+					}
+				}
+				res[p]++
+			}
+		}
+	}
+	return res
+}
+
+// MissingPairs returns every combination of a key in allKeys and a value in allValues that is not
+// associated in the map, ordered by key and then value in the order they appear in the arguments
+func (m *BiMultiMap[K, V]) MissingPairs(allKeys []K, allValues []V) []Pair[K, V] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make([]Pair[K, V], 0)
+	for _, k := range allKeys {
+		present := make(map[V]struct{}, len(m.forward[k]))
+		for _, v := range m.forward[k] {
+			present[v] = struct{}{}
+		}
+
+		for _, v := range allValues {
+			if _, found := present[v]; !found {
+				res = append(res, Pair[K, V]{Key: k, Value: v})
+			}
+		}
+	}
+	return res
+}
+
+// CrossCount returns the total number of values associated with the given keys, i.e. the sum of their
+// degrees. This is the number of rows a join on those keys would produce
+func (m *BiMultiMap[K, V]) CrossCount(keys ...K) int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	count := 0
+	for _, k := range keys {
+		count += len(m.forward[k])
+	}
+	return count
+}
+
+// CountPairsByBucket returns the number of key/value pairs for each bucket, where the bucket of a
+// pair is given by calling bucket on its key. bucket is called with the read lock held, so it must not
+// modify the map
+func (m *BiMultiMap[K, V]) CountPairsByBucket(bucket func(K) string) map[string]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make(map[string]int)
+	for k, values := range m.forward {
+		res[bucket(k)] += len(values)
+	}
+	return res
+}
+
+// ImpactOfDeleteValue reports what DeleteValue would do without modifying the map: how many keys
+// are associated with the value, and how many of those would be left without any values
+func (m *BiMultiMap[K, V]) ImpactOfDeleteValue(value V) (keysAffected int, keysEmptied int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := m.keysOf(value)
+	seen := make(map[K]struct{}, len(keys))
+	for _, k := range keys {
+		if _, found := seen[k]; found {
+			continue
+		}
+		seen[k] = struct{}{}
+
+		keysAffected++
+		if !slices.ContainsFunc(m.forward[k], func(v V) bool { return v != value }) {
+			keysEmptied++
+		}
+	}
+	return keysAffected, keysEmptied
+}
+
+// ValuesOrphanedByDeletingKey reports which values DeleteKey would remove from the map without
+// modifying it, i.e. the values of the key that are not associated with any other key
+func (m *BiMultiMap[K, V]) ValuesOrphanedByDeletingKey(key K) []V {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make([]V, 0)
+	for _, v := range uniqueElements(m.forward[key]) {
+		if !slices.ContainsFunc(m.keysOf(v), func(k K) bool { return k != key }) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// ValueNeighborhood returns, for every key associated with a value, a copy of all of the values of that
+// key, including the value itself. It returns an empty map if the value does not exist
+func (m *BiMultiMap[K, V]) ValueNeighborhood(value V) map[K][]V {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make(map[K][]V)
+	for _, k := range m.keysOf(value) {
+		res[k] = slices.Clone(m.forward[k])
+	}
+	return res
+}
+
+// ValuesByPopularity returns all values sorted by the number of keys associated with them, most
+// popular first. Ties are broken by comparing the values formatted with fmt, so the order is
+// deterministic unless different values have the same string representation
+func (m *BiMultiMap[K, V]) ValuesByPopularity() []V {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	inverse := m.inverseIndex()
+	values := make([]V, 0, len(inverse))
+	labels := make(map[V]string, len(inverse))
+	for v := range inverse {
+		values = append(values, v)
+		labels[v] = fmt.Sprint(v)
+	}
+
+	slices.SortFunc(values, func(a, b V) int {
+		if c := cmp.Compare(len(inverse[b]), len(inverse[a])); c != 0 {
+			return c
+		}
+		return cmp.Compare(labels[a], labels[b])
+	})
+	return values
+}
+
+// KeyValuesContainedIn returns true if every value of key a is also a value of key b. It returns false
+// if a does not exist, and true if a exists but has no values
+func (m *BiMultiMap[K, V]) KeyValuesContainedIn(a, b K) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	values, found := m.forward[a]
+	if !found {
+		return false
+	}
+	return isSubset(values, m.forward[b])
+}
+
+// KeysSubsumedBy returns all other keys whose values are a subset of the values of the given key, in
+// no particular order
+func (m *BiMultiMap[K, V]) KeysSubsumedBy(key K) []K {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make([]K, 0)
+	values, found := m.forward[key]
+	if !found {
+		return res
+	}
+
+	candidates := make(map[K]struct{})
+	for _, v := range values {
+		for _, k := range m.keysOf(v) {
+			if k != key {
+				candidates[k] = struct{}{}
+			}
+		}
+	}
+
+	for k := range candidates {
+		if isSubset(m.forward[k], values) {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// MaxDisjointKeys returns a set of keys whose values are pairwise disjoint, in no particular order.
+// Finding the largest such set is NP-hard, so it uses a greedy heuristic instead: keys are considered
+// from the fewest to the most values, and a key is picked if none of its values belongs to a key that
+// was already picked. The result is maximal, i.e. no other key can be added to it, but not
+// necessarily the largest possible
+func (m *BiMultiMap[K, V]) MaxDisjointKeys() []K {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := make([]K, 0, len(m.forward))
+	for k := range m.forward {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b K) int {
+		return cmp.Compare(len(m.forward[a]), len(m.forward[b]))
+	})
+
+	res := make([]K, 0)
+	used := make(map[V]struct{})
+	for _, k := range keys {
+		if slices.ContainsFunc(m.forward[k], func(v V) bool {
+			_, found := used[v]
+			return found
+		}) {
+			continue
+		}
+		for _, v := range m.forward[k] {
+			used[v] = struct{}{}
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+// IsBijection returns true if the map is a one-to-one correspondence between its keys and values:
+// every key has exactly one value, every value has exactly one key, and there are as many keys as
+// values. An empty map is trivially a bijection
+func (m *BiMultiMap[K, V]) IsBijection() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	inverse := m.inverseIndex()
+	if len(m.forward) != len(inverse) {
+		return false
+	}
+	for _, values := range m.forward {
+		if len(values) != 1 {
+			return false
+		}
+	}
+	for _, keys := range inverse {
+		if len(keys) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal returns true if both maps have the same keys and every key has the same set of values in both,
+// regardless of the order in which they were added
+func (m *BiMultiMap[K, V]) Equal(other *BiMultiMap[K, V]) bool {
+	unlock := m.rlockBoth(other)
+	defer unlock()
+
+	if len(m.forward) != len(other.forward) {
+		return false
+	}
+	for k, values := range m.forward {
+		otherValues, found := other.forward[k]
+		if !found || !isSubset(values, otherValues) || !isSubset(otherValues, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsAll returns true if every key/value pair in sub is also in this map
+func (m *BiMultiMap[K, V]) ContainsAll(sub *BiMultiMap[K, V]) bool {
+	unlock := m.rlockBoth(sub)
+	defer unlock()
+
+	for k, values := range sub.forward {
+		if !isSubset(values, m.forward[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// UnionPairCount returns the number of distinct key/value pairs in the union of this map and the
+// other one, without building the union
+func (m *BiMultiMap[K, V]) UnionPairCount(other *BiMultiMap[K, V]) int {
+	unlock := m.rlockBoth(other)
+	defer unlock()
+
+	count := 0
+	for _, values := range m.forward {
+		count += len(uniqueElements(values))
+	}
+	for k, values := range other.forward {
+		mine := make(map[V]struct{}, len(m.forward[k]))
+		for _, v := range m.forward[k] {
+			mine[v] = struct{}{}
+		}
+		for _, v := range uniqueElements(values) {
+			if _, found := mine[v]; !found {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// KeysNotIn returns the keys of this map that are not keys of the other map, in no particular order
+func (m *BiMultiMap[K, V]) KeysNotIn(other *BiMultiMap[K, V]) []K {
+	unlock := m.rlockBoth(other)
+	defer unlock()
+
+	res := make([]K, 0)
+	for k := range m.forward {
+		if _, found := other.forward[k]; !found {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// ValuesNotIn returns the values of this map that are not values of the other map, regardless of
+// which keys they are associated with, in no particular order
+func (m *BiMultiMap[K, V]) ValuesNotIn(other *BiMultiMap[K, V]) []V {
+	unlock := m.rlockBoth(other)
+	defer unlock()
+
+	res := make([]V, 0)
+	others := other.inverseIndex()
+	for v := range m.inverseIndex() {
+		if _, found := others[v]; !found {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// KeysChangedFrom returns the keys whose values differ between this map and a baseline map, either
+// because the key is only in one of the maps or because it has different values in each, in no
+// particular order. Only the sets of values are compared, so the multiplicities of maps created with
+// NewMultiset are ignored
+func (m *BiMultiMap[K, V]) KeysChangedFrom(baseline *BiMultiMap[K, V]) []K {
+	unlock := m.rlockBoth(baseline)
+	defer unlock()
+
+	res := make([]K, 0)
+	for k, values := range m.forward {
+		if old, found := baseline.forward[k]; !found || !sameElements(old, values) {
+			res = append(res, k)
+		}
+	}
+	for k := range baseline.forward {
+		if _, found := m.forward[k]; !found {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// SharedValues returns the values that are associated with a key both in this map and in the other map,
+// in the order in which they were added to the key in this map
+func (m *BiMultiMap[K, V]) SharedValues(other *BiMultiMap[K, V], key K) []V {
+	unlock := m.rlockBoth(other)
+	defer unlock()
+
+	res := make([]V, 0)
+	for _, v := range uniqueElements(m.forward[key]) {
+		if other.pairCount[Pair[K, V]{Key: key, Value: v}] > 0 {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// OrphanKeys returns the keys of the map that are not in the given set of valid keys, in no
+// particular order
+func (m *BiMultiMap[K, V]) OrphanKeys(valid map[K]struct{}) []K {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make([]K, 0)
+	for k := range m.forward {
+		if _, found := valid[k]; !found {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// OrphanValues returns the values of the map that are not in the given set of valid values, in no
+// particular order
+func (m *BiMultiMap[K, V]) OrphanValues(valid map[V]struct{}) []V {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make([]V, 0)
+	for v := range m.inverseIndex() {
+		if _, found := valid[v]; !found {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// rlockBoth acquires the read locks of this map and another one, always in the same order so that
+// two goroutines locking the same two maps cannot deadlock, and returns a function that releases them
+func (m *BiMultiMap[K, V]) rlockBoth(other *BiMultiMap[K, V]) func() {
+	if m == other {
+		m.mutex.RLock()
+		return m.mutex.RUnlock
+	}
+
+	first, second := m, other
+	if uintptr(unsafe.Pointer(other)) < uintptr(unsafe.Pointer(m)) {
+		first, second = other, m
+	}
+
+	first.mutex.RLock()
+	second.mutex.RLock()
+	return func() {
+		second.mutex.RUnlock()
+		first.mutex.RUnlock()
+	}
+}
+
+// Helper function: compute an order-independent fingerprint of the elements of a slice
+func fingerprint[T comparable](slice []T) string {
+	parts := make([]string, 0, len(slice))
+	for _, val := range slice {
+		parts = append(parts, fmt.Sprintf("%#v", val))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\x00")
+}
+
+// Helper function: return the distinct elements of a slice, in the order they first appear
+func uniqueElements[T comparable](slice []T) []T {
+	seen := make(map[T]struct{}, len(slice))
+	res := make([]T, 0, len(slice))
+	for _, val := range slice {
+		if _, found := seen[val]; !found {
+			seen[val] = struct{}{}
+			res = append(res, val)
+		}
+	}
+	return res
+}
+
+// Helper function: check whether every element of a is also an element of b
+func isSubset[T comparable](a, b []T) bool {
+	set := make(map[T]struct{}, len(b))
+	for _, val := range b {
+		set[val] = struct{}{}
+	}
+	for _, val := range a {
+		if _, found := set[val]; !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper function: check whether two slices contain the same set of elements, regardless of order and
+// of how many times each element is repeated
+func sameElements[T comparable](a, b []T) bool {
+	setA := make(map[T]struct{}, len(a))
+	for _, val := range a {
+		setA[val] = struct{}{}
+	}
+	setB := make(map[T]struct{}, len(b))
+	for _, val := range b {
+		if _, found := setA[val]; !found {
+			return false
+		}
+		setB[val] = struct{}{}
+	}
+	return len(setA) == len(setB)
+}
+
+// Helper function: deep copy one of the indexes
+func cloneIndex[A comparable, B comparable](index map[A][]B) map[A][]B {
+	res := make(map[A][]B, len(index))
+	for k, v := range index {
+		res[k] = slices.Clone(v)
+	}
+	return res
+}
+
+// Helper function: check whether a slice contains an element
+func containsElement[T comparable](slice []T, element T) bool {
+	for _, val := range slice {
+		if val == element {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function: delete the first occurrence of an element from a slice if it exists. The slice is
+// modified in place and keeps its capacity
+func deleteFirstElement[T comparable](slice []T, element T) []T {
+	if i := slices.Index(slice, element); i >= 0 {
+		return slices.Delete(slice, i, i+1)
+	}
+	return slice
+}
+
+// Helper function: delete an element from a slice if it exists. The slice is modified in place and
+// keeps its capacity
+func deleteElement[T comparable](slice []T, element T) []T {
+	return slices.DeleteFunc(slice, func(val T) bool {
+		return val == element
+	})
+}
+
+// Helper function: reallocate a slice if less than a quarter of its capacity is in use
+func compactSlice[T any](slice []T) []T {
+	if len(slice) < cap(slice)/4 {
+		return slices.Clone(slice)
+	}
+	return slice
 }
@@ -1,6 +1,11 @@
 package bimultimap
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,12 +14,38 @@ import (
 func TestNewBiMultiMap(t *testing.T) {
 	sut := New[string, string]()
 	expected := &BiMultiMap[string, string]{
-		forward: make(map[string][]string),
-		inverse: make(map[string][]string),
+		forward:   make(map[string][]string),
+		inverse:   make(map[string][]string),
+		pairCount: make(map[Pair[string, string]]int),
 	}
 	assert.Equal(t, expected, sut, "a new BiMultiMap should be empty")
 }
 
+func TestCollect(t *testing.T) {
+	original := biMultiMapWithMultipleKeysValues()
+	original.Add("key3", "value3")
+
+	pairs := func(yield func(string, string) bool) {
+		for _, k := range original.Keys() {
+			for _, v := range original.LookupKey(k) {
+				// Yield every pair twice to check that duplicates are ignored
+				if !yield(k, v) || !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+	sut := Collect(pairs)
+
+	assert.ElementsMatch(t, original.Keys(), sut.Keys(), "the collected map should have the same keys")
+	for _, k := range original.Keys() {
+		assert.ElementsMatch(t, original.LookupKey(k), sut.LookupKey(k), "the collected map should have the same values for %s", k)
+	}
+	for _, v := range original.Values() {
+		assert.ElementsMatch(t, original.LookupValue(v), sut.LookupValue(v), "the collected map should have the same keys for %s", v)
+	}
+}
+
 func TestBiMultiMapPut(t *testing.T) {
 	sut := New[string, string]()
 	sut.Add("key", "value")
@@ -38,6 +69,61 @@ func TestBiMultiMapPutDup(t *testing.T) {
 	assert.ElementsMatch(t, []string{"key"}, sut.LookupValue("value"), "the key associated with the value should not be duplicated")
 }
 
+func TestMultisetPutDup(t *testing.T) {
+	sut := NewMultiset[string, string]()
+	sut.Add("key", "value")
+	sut.Add("key", "value")
+
+	assert.Equal(t, []string{"value", "value"}, sut.LookupKey("key"), "the value should be repeated according to its multiplicity")
+	assert.Equal(t, []string{"key", "key"}, sut.LookupValue("value"), "the key should be repeated according to its multiplicity")
+}
+
+func TestMultisetDeleteKeyValue(t *testing.T) {
+	sut := NewMultiset[string, string]()
+	sut.Add("key", "value")
+	sut.Add("key", "value")
+
+	sut.DeleteKeyValue("key", "value")
+	assert.Equal(t, []string{"value"}, sut.LookupKey("key"), "deleting a pair should decrement its multiplicity")
+	assert.Equal(t, []string{"key"}, sut.LookupValue("value"), "deleting a pair should decrement its inverse multiplicity")
+
+	sut.DeleteKeyValue("key", "value")
+	assert.False(t, sut.KeyExists("key"), "deleting the last occurrence should delete the key")
+	assert.False(t, sut.ValueExists("value"), "deleting the last occurrence should delete the value")
+}
+
+func TestMultisetDeleteKey(t *testing.T) {
+	sut := NewMultiset[string, string]()
+	sut.Add("key", "value")
+	sut.Add("key", "value")
+	sut.Add("other", "value")
+
+	values := sut.DeleteKey("key")
+
+	assert.Equal(t, []string{"value", "value"}, values, "deleting a key should return every occurrence")
+	assert.Equal(t, []string{"other"}, sut.LookupValue("value"), "deleting a key should remove every occurrence from the inverse")
+}
+
+func TestValidator(t *testing.T) {
+	errEmpty := errors.New("empty value")
+	sut := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errEmpty
+		}
+		return nil
+	})
+
+	assert.NoError(t, sut.AddValidated("key", "value"), "a valid pair should be accepted")
+	assert.ErrorIs(t, sut.AddValidated("key", ""), errEmpty, "the validator's error should be returned")
+	sut.Add("key", "")
+	sut.Add("other", "value")
+
+	assert.ElementsMatch(t, []string{"value"}, sut.LookupKey("key"), "rejected pairs should not be added")
+	assert.False(t, sut.ValueExists(""), "rejected values should not be added")
+	assert.ElementsMatch(t, []string{"key", "other"}, sut.LookupValue("value"), "valid pairs should be added with Add")
+	assert.NoError(t, New[string, string]().AddValidated("key", ""), "a map without a validator should accept anything")
+}
+
 func TestBiMultiMapMultiPut(t *testing.T) {
 	sut := biMultiMapWithMultipleKeysValues()
 
@@ -50,6 +136,287 @@ func TestBiMultiMapMultiPut(t *testing.T) {
 	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value1"), "the keys associated with the value should be the correct one")
 }
 
+func TestBiMultiMapAddCross(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+
+	sut.AddCross([]string{"key1", "key2"}, []string{"value1", "value2", "value3"})
+
+	for _, k := range []string{"key1", "key2"} {
+		assert.Equal(t, []string{"value1", "value2", "value3"}, sut.LookupKey(k), "every value should be added to each key once")
+	}
+	for _, v := range []string{"value1", "value2", "value3"} {
+		assert.Equal(t, []string{"key1", "key2"}, sut.LookupValue(v), "the inverse should be consistent")
+	}
+
+	validated := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	})
+	validated.AddCross([]string{"key1", "key2"}, []string{"value1", ""})
+	assert.False(t, validated.ValueExists(""), "rejected pairs should not be added")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, validated.LookupValue("value1"), "valid pairs should be added")
+}
+
+func TestBiMultiMapLookupReturnsCopy(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	values := sut.LookupKey("key1")
+	values[0] = "changed"
+	_ = append(values[:1], "appended")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "modifying the returned values should not affect the map")
+
+	keys := sut.LookupValue("value1")
+	keys[0] = "changed"
+	_ = append(keys[:1], "appended")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value1"), "modifying the returned keys should not affect the map")
+	assert.False(t, sut.KeyExists("changed"), "modifying the returned keys should not affect the map")
+}
+
+func TestBiMultiMapCopyKeyEntry(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	key, values, found := sut.CopyKeyEntry("key1")
+	assert.True(t, found, "an existing key should be found")
+	assert.Equal(t, "key1", key, "the key should be returned")
+	assert.Equal(t, []string{"value1", "value2"}, values, "the values should be returned")
+
+	values[0] = "changed"
+	_ = append(values[:1], "appended")
+	assert.Equal(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "modifying the copy should not affect the map")
+
+	_, values, found = sut.CopyKeyEntry("foo")
+	assert.False(t, found, "a nonexistent key should not be found")
+	assert.Nil(t, values, "a nonexistent key has no values")
+}
+
+func TestBiMultiMapLookupValueLimit(t *testing.T) {
+	sut := New[string, string]()
+	for i := 0; i < 10; i++ {
+		sut.Add(fmt.Sprintf("key%d", i), "value")
+	}
+
+	keys := sut.LookupValueLimit("value", 5)
+	assert.Equal(t, []string{"key0", "key1", "key2", "key3", "key4"}, keys, "the first keys should be returned")
+	assert.Len(t, sut.LookupValueLimit("value", -1), 10, "a negative limit should return all keys")
+	assert.Len(t, sut.LookupValueLimit("value", 20), 10, "a limit larger than the number of keys should return all keys")
+	assert.Equal(t, []string{}, sut.LookupValueLimit("value", 0), "a zero limit should return no keys")
+	assert.Equal(t, []string{}, sut.LookupValueLimit("foo", 5), "a nonexistent value should return an empty slice")
+
+	keys[0] = "changed"
+	assert.Equal(t, "key0", sut.LookupValueLimit("value", 1)[0], "the returned slice should be a copy")
+}
+
+func TestBiMultiMapContains(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	assert.True(t, sut.Contains("key1", "value1"), "an existing pair should be found")
+	assert.False(t, sut.Contains("key1", "value3"), "a value of another key should not be found")
+	assert.False(t, sut.Contains("foo", "value1"), "a nonexistent key should not be found")
+
+	sut.DeleteKeyValue("key1", "value1")
+	assert.False(t, sut.Contains("key1", "value1"), "a deleted pair should not be found")
+}
+
+func TestBiMultiMapContainsMultiset(t *testing.T) {
+	sut := NewMultiset[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value1")
+
+	sut.DeleteKeyValue("key1", "value1")
+	assert.True(t, sut.Contains("key1", "value1"), "one occurrence of the pair should remain")
+	sut.DeleteKeyValue("key1", "value1")
+	assert.False(t, sut.Contains("key1", "value1"), "deleting the last occurrence should remove the pair")
+
+	sut.Add("key1", "value1")
+	clone := sut.Clone()
+	sut.DeleteValue("value1")
+	assert.False(t, sut.Contains("key1", "value1"), "deleting a value should remove all of its pairs")
+	assert.False(t, sut.Contains("key2", "value1"), "deleting a value should remove all of its pairs")
+	assert.True(t, clone.Contains("key1", "value1"), "the clone should keep its own pairs")
+
+	clone.DeleteKey("key1")
+	assert.False(t, clone.Contains("key1", "value1"), "deleting a key should remove all of its pairs")
+	clone.Clear()
+	assert.False(t, clone.Contains("key2", "value1"), "clearing the map should remove all pairs")
+}
+
+func TestBiMultiMapAddMany(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	sut.AddMany("key1", "value2", "value3", "value3")
+	sut.AddMany("key3", "value3")
+	sut.AddMany("key4")
+
+	assert.Equal(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key1"), "existing and repeated values should not be duplicated")
+	assert.Equal(t, []string{"key1", "key2"}, sut.LookupValue("value2"), "existing pairs should not duplicate the inverse")
+	assert.Equal(t, []string{"key1", "key3"}, sut.LookupValue("value3"), "the inverse should be consistent")
+	assert.False(t, sut.KeyExists("key4"), "adding no values should not create the key")
+}
+
+func TestBiMultiMapAddAll(t *testing.T) {
+	sut := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	})
+	sut.AddMany("key1", "value1", "value2")
+	sut.AddMany("key2", "value1", "value2")
+	pairs := []Pair[string, string]{
+		{Key: "key1", Value: "value1"},
+		{Key: "key3", Value: "value3"},
+		{Key: "key3", Value: "value3"},
+		{Key: "key3", Value: ""},
+	}
+
+	sut.AddAll(func(yield func(string, string) bool) {
+		for _, p := range pairs {
+			if !yield(p.Key, p.Value) {
+				return
+			}
+		}
+	})
+
+	assert.Equal(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "existing pairs should not be duplicated")
+	assert.Equal(t, []string{"key1", "key2"}, sut.LookupValue("value1"), "existing pairs should not duplicate the inverse")
+	assert.Equal(t, []string{"value3"}, sut.LookupKey("key3"), "repeated pairs should be added once")
+	assert.Equal(t, []string{"key3"}, sut.LookupValue("value3"), "the inverse should be consistent")
+	assert.False(t, sut.ValueExists(""), "pairs rejected by the validator should be skipped")
+}
+
+func TestBiMultiMapPairIndex(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key", "value1")
+	sut.Add("key", "value2")
+	sut.Add("key", "value3")
+
+	assert.Equal(t, 0, sut.PairIndex("key", "value1"), "the first value should be at index 0")
+	assert.Equal(t, 1, sut.PairIndex("key", "value2"), "the second value should be at index 1")
+	assert.Equal(t, 2, sut.PairIndex("key", "value3"), "the third value should be at index 2")
+	assert.Equal(t, -1, sut.PairIndex("key", "value4"), "a nonexistent value should return -1")
+	assert.Equal(t, -1, sut.PairIndex("foo", "value1"), "a nonexistent key should return -1")
+
+	sut.DeleteKeyValue("key", "value1")
+	assert.Equal(t, 0, sut.PairIndex("key", "value2"), "deleting a value should shift the later ones")
+}
+
+func TestBiMultiMapKeyMeta(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	sut.SetKeyMeta("key1", 42)
+	meta, found := sut.KeyMeta("key1")
+	assert.True(t, found, "the metadata should be found")
+	assert.Equal(t, 42, meta, "the metadata should be returned")
+
+	sut.DeleteKeyValue("key1", "value1")
+	_, found = sut.KeyMeta("key1")
+	assert.True(t, found, "the metadata should be kept while the key has values")
+
+	sut.DeleteKeyValue("key1", "value2")
+	_, found = sut.KeyMeta("key1")
+	assert.False(t, found, "the metadata should be discarded with the key")
+
+	sut.Add("key1", "value1")
+	_, found = sut.KeyMeta("key1")
+	assert.False(t, found, "a key added again should not get its old metadata back")
+
+	sut.SetKeyMeta("foo", "bar")
+	_, found = sut.KeyMeta("foo")
+	assert.False(t, found, "metadata should not be attached to a nonexistent key")
+}
+
+func TestBiMultiMapFirstValueFirstKey(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key2", "value2")
+	sut.Add("key1", "value2")
+	sut.Add("key1", "value1")
+
+	value, found := sut.FirstValue("key1")
+	assert.True(t, found, "an existing key should be found")
+	assert.Equal(t, "value2", value, "the earliest value should be returned")
+
+	key, found := sut.FirstKey("value2")
+	assert.True(t, found, "an existing value should be found")
+	assert.Equal(t, "key2", key, "the earliest key should be returned")
+
+	sut.DeleteKeyValue("key1", "value2")
+	value, _ = sut.FirstValue("key1")
+	assert.Equal(t, "value1", value, "deleting the first value should promote the next one")
+
+	_, found = sut.FirstValue("foo")
+	assert.False(t, found, "a nonexistent key should not be found")
+	_, found = sut.FirstKey("foo")
+	assert.False(t, found, "a nonexistent value should not be found")
+}
+
+func TestBiMultiMapSetKeyCapacity(t *testing.T) {
+	sut := New[string, string]()
+	sut.SetKeyCapacity(2)
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key2", "value1")
+
+	sut.Add("key1", "value3")
+
+	assert.Equal(t, []string{"value2", "value3"}, sut.LookupKey("key1"), "the oldest value should be evicted")
+	assert.Equal(t, []string{"key2"}, sut.LookupValue("value1"), "the evicted pair should be removed from the inverse")
+	assert.Equal(t, []string{"key1"}, sut.LookupValue("value3"), "the new pair should be added to the inverse")
+}
+
+func TestBiMultiMapSetKeyCapacityExisting(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key", "value1")
+	sut.Add("key", "value2")
+	sut.Add("key", "value3")
+
+	sut.SetKeyCapacity(1)
+	assert.Equal(t, []string{"value3"}, sut.LookupKey("key"), "keys over capacity should be trimmed immediately")
+	assert.False(t, sut.ValueExists("value1"), "trimmed values should be removed from the inverse")
+
+	sut.SetKeyCapacity(0)
+	sut.Add("key", "value4")
+	assert.Equal(t, []string{"value3", "value4"}, sut.LookupKey("key"), "a capacity of zero should remove the limit")
+}
+
+func TestBiMultiMapKeyGeneration(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+	generation := sut.KeyGeneration()
+
+	sut.Add("key1", "value2")
+	sut.DeleteKeyValue("key1", "value2")
+	assert.Equal(t, generation, sut.KeyGeneration(), "changing the values of an existing key should not change the generation")
+
+	sut.Add("key2", "value1")
+	assert.Greater(t, sut.KeyGeneration(), generation, "adding a key should change the generation")
+
+	generation = sut.KeyGeneration()
+	sut.DeleteValue("value1")
+	assert.Greater(t, sut.KeyGeneration(), generation, "removing keys should change the generation")
+}
+
+func TestBiMultiMapSortKeyValues(t *testing.T) {
+	sut := New[string, int]()
+	sut.Add("key", 2)
+	sut.Add("key", 5)
+	sut.Add("key", 1)
+	sut.Add("key", 3)
+
+	sut.SortKeyValues("key", func(a, b int) bool { return a > b })
+
+	assert.Equal(t, []int{5, 3, 2, 1}, sut.LookupKey("key"), "the values should be sorted in descending order")
+	assert.Equal(t, []int{5, 3, 2, 1}, sut.LookupKey("key"), "the order should persist across lookups")
+	assert.Equal(t, []string{"key"}, sut.LookupValue(1), "sorting should not affect the inverse")
+
+	sut.SortKeyValues("missing", func(a, b int) bool { return a > b })
+	assert.False(t, sut.KeyExists("missing"), "sorting a nonexistent key should not create it")
+}
+
 func TestBiMultiMapGetEmpty(t *testing.T) {
 	sut := New[string, string]()
 	assert.ElementsMatch(t, []string{}, sut.LookupValue("foo"), "a nonexistent key should return an empty slice")
@@ -71,6 +438,36 @@ func TestBiMultiMapDeleteKey(t *testing.T) {
 	assert.ElementsMatch(t, []string{"value"}, value, "deleting a key should return its associated values")
 }
 
+func TestBiMultiMapClearKey(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	values := sut.ClearKey("key1")
+
+	assert.ElementsMatch(t, []string{"value1", "value2"}, values, "clearing a key should return its values")
+	assert.False(t, sut.KeyExists("key1"), "by default a cleared key should be removed")
+	assert.ElementsMatch(t, []string{"key2"}, sut.LookupValue("value1"), "the inverse should be updated")
+	assert.ElementsMatch(t, []string{}, sut.ClearKey("key4"), "clearing a nonexistent key should return an empty slice")
+}
+
+func TestRetainingEmptyKeysClearKey(t *testing.T) {
+	sut := NewRetainingEmptyKeys[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key2", "value2")
+
+	values := sut.ClearKey("key1")
+
+	assert.ElementsMatch(t, []string{"value1", "value2"}, values, "clearing a key should return its values")
+	assert.True(t, sut.KeyExists("key1"), "the cleared key should be retained")
+	assert.ElementsMatch(t, []string{}, sut.LookupKey("key1"), "the cleared key should have no values")
+	assert.False(t, sut.ValueExists("value1"), "a value left without keys should be removed")
+	assert.ElementsMatch(t, []string{"key2"}, sut.LookupValue("value2"), "the inverse should be updated")
+
+	sut.Add("key1", "value3")
+	assert.ElementsMatch(t, []string{"value3"}, sut.LookupKey("key1"), "values can be added to a retained key")
+}
+
 func TestBiMultiMapDeleteValue(t *testing.T) {
 	sut := New[string, string]()
 	sut.Add("key", "value")
@@ -82,6 +479,62 @@ func TestBiMultiMapDeleteValue(t *testing.T) {
 	assert.ElementsMatch(t, []string{"key"}, value, "deleting a value should return its associated keys")
 }
 
+func TestBiMultiMapDeleteValueConcurrent(t *testing.T) {
+	sut := New[string, int]()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				sut.Add(fmt.Sprintf("key%d", j%10), j%5)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				sut.DeleteValue(j % 5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, k := range sut.Keys() {
+		for _, v := range sut.LookupKey(k) {
+			assert.Contains(t, sut.LookupValue(v), k, "the inverse should be consistent with the forward index")
+		}
+	}
+}
+
+func TestBiMultiMapKeysValuesConcurrent(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			sut.Add(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+			sut.DeleteKey(fmt.Sprintf("key%d", i-1))
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		keys := sut.Keys()
+		values := sut.Values()
+		sut.Add("snapshot", "snapshot")
+		assert.NotContains(t, keys, "snapshot", "later changes should not show up in a snapshot of the keys")
+		assert.NotContains(t, values, "snapshot", "later changes should not show up in a snapshot of the values")
+		sut.DeleteKey("snapshot")
+	}
+}
+
 func TestBiMultiMapDeleteMultiKey(t *testing.T) {
 	sut := biMultiMapWithMultipleKeysValues()
 
@@ -102,6 +555,20 @@ func TestBiMultiMapDeleteMultiValue(t *testing.T) {
 	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key1"), "deleting a value should delete the inverse")
 }
 
+func TestBiMultiMapDeleteRemovesEmptied(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value2")
+
+	sut.DeleteKey("key1")
+	sut.DeleteValue("value2")
+
+	assert.False(t, sut.ValueExists("value1"), "a value left without keys by DeleteKey should be removed")
+	assert.False(t, sut.KeyExists("key2"), "a key left without values by DeleteValue should be removed")
+	assert.Empty(t, sut.Keys(), "there should be no keys left")
+	assert.Empty(t, sut.Values(), "there should be no values left")
+}
+
 func TestMultiMapDeleteKeyValue(t *testing.T) {
 	sut := biMultiMapWithMultipleKeysValues()
 
@@ -113,54 +580,1356 @@ func TestMultiMapDeleteKeyValue(t *testing.T) {
 	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value2"), "deleting a key/value pair should not affect other values")
 }
 
-func TestBiMultiMapKeysValues(t *testing.T) {
+func TestBiMultiMapTakePair(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	var wg sync.WaitGroup
+	var taken atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sut.TakePair("key1", "value1") {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), taken.Load(), "exactly one goroutine should take the pair")
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key1"), "the pair should be deleted")
+	assert.ElementsMatch(t, []string{"key2"}, sut.LookupValue("value1"), "the pair should be deleted from the inverse")
+	assert.False(t, sut.TakePair("key3", "value1"), "taking a nonexistent pair should fail")
+}
+
+func TestBiMultiMapRemoveValueFromKeys(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	removed := sut.RemoveValueFromKeys("value1", "key1", "key3")
+
+	assert.Equal(t, 1, removed, "only existing pairs should be counted as removed")
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key1"), "value1 should be removed from key1")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key2"), "key2 should still have value1")
+	assert.ElementsMatch(t, []string{"key2"}, sut.LookupValue("value1"), "the inverse should be updated")
+	assert.False(t, sut.KeyExists("key3"), "a nonexistent key should not be created")
+}
+
+func TestBiMultiMapRemoveValueFromKeysEmpties(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	removed := sut.RemoveValueFromKeys("value1", "key1", "key2")
+
+	assert.Equal(t, 2, removed, "both pairs should be removed")
+	assert.False(t, sut.ValueExists("value1"), "a value without keys should be removed")
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key1"), "key1 should keep its other values")
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key2"), "key2 should keep its other values")
+}
+
+func TestAutoCompacting(t *testing.T) {
+	sut := NewAutoCompacting[string, int]()
+	for i := 0; i < 1000; i++ {
+		sut.Add("key", i)
+	}
+	assert.GreaterOrEqual(t, cap(sut.forward["key"]), 1000, "the slice should have grown")
+
+	for i := 0; i < 990; i++ {
+		sut.DeleteKeyValue("key", i)
+	}
+
+	assert.Less(t, cap(sut.forward["key"]), 250, "the slice should have been compacted")
+	assert.Len(t, sut.LookupKey("key"), 10, "compaction should keep the remaining values")
+	assert.ElementsMatch(t, []string{"key"}, sut.LookupValue(999), "compaction should not affect the inverse")
+}
+
+func TestDeleteKeepsCapacity(t *testing.T) {
+	sut := New[string, int]()
+	for i := 0; i < 1000; i++ {
+		sut.Add("key", i)
+	}
+
+	for i := 0; i < 990; i++ {
+		sut.DeleteKeyValue("key", i)
+	}
+
+	assert.GreaterOrEqual(t, cap(sut.forward["key"]), 1000, "without auto-compaction the capacity should be kept")
+	assert.Len(t, sut.LookupKey("key"), 10, "deleting should keep the remaining values")
+}
+
+func TestDeleteInPlaceDoesNotChangeLookups(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key", "a")
+	sut.Add("key", "b")
+	sut.Add("key", "c")
+	sut.Add("key2", "a")
+
+	values := sut.LookupKey("key")
+	keys := sut.LookupValue("a")
+	sut.DeleteKeyValue("key", "a")
+
+	assert.Equal(t, []string{"a", "b", "c"}, values, "a slice returned by LookupKey should not change when the key's values are deleted")
+	assert.Equal(t, []string{"key", "key2"}, keys, "a slice returned by LookupValue should not change when the value's keys are deleted")
+}
+
+func TestBiMultiMapRenameKeys(t *testing.T) {
 	sut := biMultiMapWithMultipleKeysValues()
 	sut.Add("key3", "value3")
 
-	keys := sut.Keys()
-	values := sut.Values()
+	renamed := sut.RenameKeys(map[string]string{"key1": "new1", "key3": "key2", "missing": "new4"})
 
-	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, keys, "Keys() should return a slice containing the keys")
-	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, values, "Values() should return a slice containing the keys")
+	assert.Equal(t, 2, renamed, "only existing keys should be renamed")
+	assert.ElementsMatch(t, []string{"new1", "key2"}, sut.Keys(), "the old keys should be gone")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("new1"), "the renamed key should keep its values")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key2"), "renaming onto an existing key should merge the values")
+	assert.ElementsMatch(t, []string{"new1", "key2"}, sut.LookupValue("value1"), "the inverse should be updated without duplicates")
+	assert.ElementsMatch(t, []string{"key2"}, sut.LookupValue("value3"), "the inverse should be updated")
 }
 
-func TestBiMultiMapClear(t *testing.T) {
+func TestBiMultiMapRenameKeysSwap(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value2")
+
+	renamed := sut.RenameKeys(map[string]string{"key1": "key2", "key2": "key1"})
+
+	assert.Equal(t, 2, renamed, "both keys should be renamed")
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key1"), "key1 should have key2's values")
+	assert.ElementsMatch(t, []string{"value1"}, sut.LookupKey("key2"), "key2 should have key1's values")
+	assert.ElementsMatch(t, []string{"key2"}, sut.LookupValue("value1"), "the inverse should follow the swap")
+}
+
+func TestBiMultiMapCoalesceValues(t *testing.T) {
 	sut := biMultiMapWithMultipleKeysValues()
-	sut.Clear()
+	sut.Add("key3", "value2")
 
-	assert.Equal(t, []string{}, sut.Keys())
-	assert.Equal(t, []string{}, sut.Values())
+	assert.True(t, sut.CoalesceValues("value1", "value2"), "coalescing an existing value should succeed")
+
+	assert.False(t, sut.ValueExists("value2"), "the dropped value should no longer exist")
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.LookupValue("value1"), "the kept value should gain the dropped value's keys")
+	assert.ElementsMatch(t, []string{"value1"}, sut.LookupKey("key1"), "keys should not end up with duplicate values")
+	assert.ElementsMatch(t, []string{"value1"}, sut.LookupKey("key3"), "keys of the dropped value should point to the kept value")
+
+	assert.False(t, sut.CoalesceValues("value1", "value4"), "coalescing a nonexistent value should fail")
 }
 
-func TestBiMultiMapMerge(t *testing.T) {
-	map1 := biMultiMapWithMultipleKeysValues()
+func TestBiMultiMapReplaceValueEverywhere(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key2", "value3")
 
-	map2 := New[string, string]()
-	map2.Add("key1", "value3")
-	map2.Add("key3", "value3")
-	map2.Add("key1", "value1")
-	map2.Add("key3", "value1")
-	map2.Add("key4", "value4")
+	assert.Equal(t, 2, sut.ReplaceValueEverywhere("value1", "value3"), "both keys should be affected")
 
-	sut := map1.Merge(map2)
+	assert.False(t, sut.ValueExists("value1"), "the old value should be removed")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value3"), "the inverse should reflect the new value")
+	assert.ElementsMatch(t, []string{"value2", "value3"}, sut.LookupKey("key1"), "the old value should be replaced")
+	assert.ElementsMatch(t, []string{"value2", "value3"}, sut.LookupKey("key2"), "a key that already had the new value should not get a duplicate")
 
-	assert.ElementsMatch(t, []string{"key1", "key2", "key3", "key4"}, sut.Keys())
-	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key1"))
-	assert.ElementsMatch(t, []string{"value1", "value3"}, sut.LookupKey("key3"))
-	assert.ElementsMatch(t, []string{"value4"}, sut.LookupKey("key4"))
+	assert.Equal(t, 0, sut.ReplaceValueEverywhere("value1", "value4"), "replacing a nonexistent value should affect no keys")
+	assert.Equal(t, 0, sut.ReplaceValueEverywhere("value2", "value2"), "replacing a value with itself should affect no keys")
+}
 
-	assert.ElementsMatch(t, []string{"value1", "value2", "value3", "value4"}, sut.Values())
-	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.LookupValue("value1"))
-	assert.ElementsMatch(t, []string{"key1", "key3"}, sut.LookupValue("value3"))
-	assert.ElementsMatch(t, []string{"key4"}, sut.LookupValue("value4"))
+func TestBiMultiMapReplaceValueEverywhereValidated(t *testing.T) {
+	sut := NewWithValidator(func(key string, value string) error {
+		if key == "key2" && value == "value3" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value1")
+
+	assert.Equal(t, 1, sut.ReplaceValueEverywhere("value1", "value3"), "only the accepted key should be affected")
+	assert.Equal(t, []string{"key1"}, sut.LookupValue("value3"), "the rejected pair should not be stored")
+	assert.Equal(t, []string{"value1"}, sut.LookupKey("key2"), "a rejected key should keep the old value")
 }
 
-func biMultiMapWithMultipleKeysValues() *BiMultiMap[string, string] {
-	m := New[string, string]()
-	m.Add("key1", "value1")
-	m.Add("key1", "value2")
-	m.Add("key2", "value1")
-	m.Add("key2", "value2")
+func TestBiMultiMapCoalesceKeys(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key2", "value3")
 
-	return m
+	assert.True(t, sut.CoalesceKeys("key1", "key2"), "coalescing an existing key should succeed")
+
+	assert.False(t, sut.KeyExists("key2"), "the dropped key should no longer exist")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key1"), "the kept key should have the union of both value sets")
+	assert.ElementsMatch(t, []string{"key1"}, sut.LookupValue("value1"), "values should not end up with duplicate keys")
+	assert.ElementsMatch(t, []string{"key1"}, sut.LookupValue("value3"), "values of the dropped key should point to the kept key")
+
+	assert.False(t, sut.CoalesceKeys("key1", "key4"), "coalescing a nonexistent key should fail")
+}
+
+func TestBiMultiMapRewriteValues(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key1", "value3")
+	sut.Add("key3", "value1")
+
+	sut.RewriteValues(func(key string, values []string) []string {
+		return slices.DeleteFunc(values, func(v string) bool { return v == "value1" })
+	})
+
+	assert.ElementsMatch(t, []string{"value2", "value3"}, sut.LookupKey("key1"), "value1 should be dropped from key1")
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key2"), "value1 should be dropped from key2")
+	assert.False(t, sut.KeyExists("key3"), "a key left without values should be removed")
+	assert.False(t, sut.ValueExists("value1"), "the inverse should be rebuilt without value1")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value2"), "the inverse should be consistent")
+}
+
+func TestBiMultiMapRewriteValuesOrderAndDuplicates(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	sut.RewriteValues(func(key string, values []string) []string {
+		return []string{"value3", "value2", "value3"}
+	})
+
+	assert.Equal(t, []string{"value3", "value2"}, sut.LookupKey("key1"), "values should be stored in the returned order without duplicates")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value3"), "new values should be added to the inverse")
+	assert.False(t, sut.ValueExists("value1"), "dropped values should be removed from the inverse")
+}
+
+func TestBiMultiMapRewriteValuesValidated(t *testing.T) {
+	sut := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	})
+	sut.Add("key", "value1")
+
+	sut.RewriteValues(func(key string, values []string) []string {
+		return append(values, "", "value2")
+	})
+
+	assert.Equal(t, []string{"value1", "value2"}, sut.LookupKey("key"), "rejected values should be dropped")
+	assert.False(t, sut.ValueExists(""), "rejected values should not be stored")
+}
+
+func TestBiMultiMapUpsert(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key", "a")
+	sut.Add("key", "b")
+	sut.Add("other", "a")
+
+	added, removed := sut.Upsert("key", []string{"c", "b"})
+
+	assert.Equal(t, []string{"c"}, added, "only the new value should be reported as added")
+	assert.Equal(t, []string{"a"}, removed, "only the dropped value should be reported as removed")
+	assert.Equal(t, []string{"c", "b"}, sut.LookupKey("key"), "the key should have exactly the given values in order")
+	assert.Equal(t, []string{"other"}, sut.LookupValue("a"), "the inverse should be updated for removed values")
+	assert.Equal(t, []string{"key"}, sut.LookupValue("c"), "the inverse should be updated for added values")
+
+	added, removed = sut.Upsert("new", []string{"d", "d"})
+	assert.Equal(t, []string{"d"}, added, "a new key should have all of its values added once")
+	assert.Empty(t, removed, "a new key has nothing to remove")
+
+	added, removed = sut.Upsert("key", nil)
+	assert.Empty(t, added, "nothing should be added")
+	assert.ElementsMatch(t, []string{"b", "c"}, removed, "every value should be removed")
+	assert.False(t, sut.KeyExists("key"), "a key upserted with no values should be removed")
+}
+
+func TestBiMultiMapUpsertValidated(t *testing.T) {
+	sut := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	})
+	sut.Add("key", "a")
+
+	added, removed := sut.Upsert("key", []string{"", "b"})
+
+	assert.Equal(t, []string{"b"}, added, "rejected values should not be reported as added")
+	assert.Equal(t, []string{"a"}, removed, "values left out should still be removed")
+	assert.Equal(t, []string{"b"}, sut.LookupKey("key"), "rejected values should not be stored")
+	assert.False(t, sut.ValueExists(""), "rejected values should not be stored")
+}
+
+func TestBiMultiMapDedupSlices(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	assert.Equal(t, 0, sut.DedupSlices(), "a consistent map has no duplicates")
+
+	// Corrupt the indexes directly
+	sut.forward["key1"] = append(sut.forward["key1"], "value1", "value2")
+	sut.inverse["value2"] = append(sut.inverse["value2"], "key2")
+
+	assert.Equal(t, 3, sut.DedupSlices(), "every injected duplicate should be removed")
+	assert.Equal(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "the forward index should be deduplicated")
+	assert.Equal(t, []string{"key1", "key2"}, sut.LookupValue("value2"), "the inverse index should be deduplicated")
+	assert.Equal(t, 0, sut.DedupSlices(), "there should be nothing left to remove")
+}
+
+func TestBiMultiMapKeysValues(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	keys := sut.Keys()
+	values := sut.Values()
+
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, keys, "Keys() should return a slice containing the keys")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, values, "Values() should return a slice containing the keys")
+}
+
+func TestBiMultiMapSize(t *testing.T) {
+	sut := New[string, string]()
+	assert.Equal(t, 0, sut.NumKeys(), "an empty map has no keys")
+	assert.Equal(t, 0, sut.NumValues(), "an empty map has no values")
+	assert.Equal(t, 0, sut.Size(), "an empty map has no pairs")
+
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key2", "value1")
+	sut.Add("key2", "value2")
+	sut.Add("key3", "value2")
+	assert.Equal(t, 3, sut.NumKeys(), "every key should be counted once")
+	assert.Equal(t, 2, sut.NumValues(), "values shared by several keys should be counted once")
+	assert.Equal(t, 5, sut.Size(), "every pair should be counted")
+
+	sut.DeleteKey("key3")
+	sut.DeleteKeyValue("key1", "value1")
+	assert.Equal(t, 2, sut.NumKeys(), "deleted keys should not be counted")
+	assert.Equal(t, 2, sut.NumValues(), "values that still have keys should be counted")
+	assert.Equal(t, 3, sut.Size(), "deleted pairs should not be counted")
+
+	sut.DeleteValue("value2")
+	assert.Equal(t, 1, sut.NumKeys(), "keys left without values should not be counted")
+	assert.Equal(t, 1, sut.NumValues(), "deleted values should not be counted")
+	assert.Equal(t, 1, sut.Size(), "deleted pairs should not be counted")
+
+	multiset := NewMultiset[string, string]()
+	multiset.Add("key1", "value1")
+	multiset.Add("key1", "value1")
+	multiset.Add("key1", "value2")
+	assert.Equal(t, 2, multiset.Size(), "a pair added several times should be counted once")
+	count := 0
+	for range multiset.Pairs() {
+		count++
+	}
+	assert.Equal(t, count, multiset.Size(), "Size should match the number of pairs yielded by Pairs")
+}
+
+func TestBiMultiMapKeySetValueSet(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	keys := sut.KeySet()
+	values := sut.ValueSet()
+
+	assert.Len(t, keys, 2, "KeySet() should contain every key once")
+	assert.Contains(t, keys, "key1", "KeySet() should contain key1")
+	assert.Contains(t, keys, "key2", "KeySet() should contain key2")
+	assert.NotContains(t, keys, "key3", "KeySet() should not contain a nonexistent key")
+
+	assert.Len(t, values, 2, "ValueSet() should contain every value once")
+	assert.Contains(t, values, "value1", "ValueSet() should contain value1")
+	assert.Contains(t, values, "value2", "ValueSet() should contain value2")
+	assert.NotContains(t, values, "value3", "ValueSet() should not contain a nonexistent value")
+
+	keys["key3"] = struct{}{}
+	assert.False(t, sut.KeyExists("key3"), "modifying the returned set should not affect the map")
+}
+
+func TestBiMultiMapGroupedByValue(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	expected := make(map[string][]string)
+	for _, v := range sut.Values() {
+		expected[v] = sut.LookupValue(v)
+	}
+
+	grouped := make(map[string][]string)
+	for v, keys := range sut.GroupedByValue() {
+		assert.NotContains(t, grouped, v, "each value should be yielded once")
+		grouped[v] = keys
+	}
+
+	assert.Equal(t, expected, grouped, "GroupedByValue() should yield every value with its keys")
+}
+
+func TestEntriesInKeyRange(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	entries := make(map[string][]string)
+	for k, values := range EntriesInKeyRange(sut, "key1", "key2") {
+		entries[k] = values
+	}
+
+	assert.Len(t, entries, 1, "only keys in the half-open range should be yielded")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, entries["key1"], "key1 should be yielded with its values")
+
+	keys := make([]string, 0)
+	for k := range EntriesInKeyRange(sut, "", "zzz") {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []string{"key1", "key2"}, keys, "keys should be yielded in order")
+}
+
+func TestBiMultiMapPairs(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	pairs := make([]Pair[string, string], 0)
+	for k, v := range sut.Pairs() {
+		pairs = append(pairs, Pair[string, string]{Key: k, Value: v})
+	}
+
+	assert.ElementsMatch(t, []Pair[string, string]{
+		{Key: "key1", Value: "value1"},
+		{Key: "key1", Value: "value2"},
+		{Key: "key2", Value: "value1"},
+		{Key: "key2", Value: "value2"},
+	}, pairs, "every pair should be yielded exactly once")
+
+	multiset := NewMultiset[string, string]()
+	multiset.Add("key", "value")
+	multiset.Add("key", "value")
+	count := 0
+	for range multiset.Pairs() {
+		count++
+	}
+	assert.Equal(t, 1, count, "a pair added several times to a multiset should be yielded once")
+
+	for k := range sut.Pairs() {
+		sut.DeleteKey(k)
+		break
+	}
+	assert.Equal(t, 1, sut.NumKeys(), "stopping early should be supported and the map can be modified while iterating")
+}
+
+func TestBiMultiMapWalk(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	visited := 0
+	sut.Walk(func(k string, v string) bool {
+		visited++
+		return visited < 2
+	})
+	assert.Equal(t, 2, visited, "the traversal should stop once the callback returns false")
+
+	pairs := make([]Pair[string, string], 0)
+	sut.Walk(func(k string, v string) bool {
+		pairs = append(pairs, Pair[string, string]{Key: k, Value: v})
+		sut.DeleteKey(k)
+		return true
+	})
+	assert.Len(t, pairs, 4, "every pair in the snapshot should be visited even if the map changes")
+}
+
+func TestBiMultiMapBatches(t *testing.T) {
+	sut := New[string, int]()
+	for i := 0; i < 10; i++ {
+		sut.Add(fmt.Sprintf("key%d", i%3), i)
+	}
+
+	sizes := make([]int, 0)
+	values := make([]int, 0)
+	for batch := range sut.Batches(4) {
+		sizes = append(sizes, len(batch))
+		for _, p := range batch {
+			assert.Contains(t, sut.LookupKey(p.Key), p.Value, "every batched pair should exist in the map")
+			values = append(values, p.Value)
+		}
+	}
+
+	assert.Equal(t, []int{4, 4, 2}, sizes, "the pairs should be split into batches of at most 4")
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, values, "every pair should be yielded once")
+}
+
+func TestBiMultiMapPartitionPairs(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	matched, unmatched := sut.PartitionPairs(func(k string, v string) bool { return v == "value1" })
+
+	assert.ElementsMatch(t, []Pair[string, string]{
+		{Key: "key1", Value: "value1"},
+		{Key: "key2", Value: "value1"},
+	}, matched, "pairs with value1 should match")
+	assert.ElementsMatch(t, []Pair[string, string]{
+		{Key: "key1", Value: "value2"},
+		{Key: "key2", Value: "value2"},
+	}, unmatched, "the other pairs should not match")
+}
+
+func TestReduce(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value1")
+
+	pairs := 0
+	for _, k := range sut.Keys() {
+		pairs += len(sut.LookupKey(k))
+	}
+
+	count := Reduce(sut, 0, func(acc int, _ string, _ string) int { return acc + 1 })
+	assert.Equal(t, pairs, count, "counting the pairs should visit each pair once")
+
+	keys := Reduce(sut, []string{}, func(acc []string, k string, v string) []string {
+		if v == "value2" {
+			return append(acc, k)
+		}
+		return acc
+	})
+	assert.ElementsMatch(t, []string{"key1", "key2"}, keys, "the accumulator should be threaded through every call")
+
+	assert.Equal(t, 42, Reduce(New[string, string](), 42, func(acc int, _ string, _ string) int { return acc + 1 }), "an empty map should return the initial value")
+}
+
+func TestBiMultiMapCanonical(t *testing.T) {
+	map1 := New[string, string]()
+	map1.Add("key1", "value1")
+	map1.Add("key1", "value2")
+	map1.Add("key2", "value1")
+
+	map2 := New[string, string]()
+	map2.Add("key2", "value1")
+	map2.Add("key1", "value3")
+	map2.Add("key1", "value2")
+	map2.Add("key1", "value1")
+	map2.DeleteKeyValue("key1", "value3")
+
+	assert.Equal(t, map1.Canonical(), map2.Canonical(), "equal maps should have the same canonical form")
+	assert.Equal(t, "\"key1\": \"value1\"\n\"key1\": \"value2\"\n\"key2\": \"value1\"\n", map1.Canonical())
+	assert.Equal(t, "", New[string, string]().Canonical(), "an empty map has an empty canonical form")
+
+	map2.Add("key3", "value1")
+	assert.NotEqual(t, map1.Canonical(), map2.Canonical(), "different maps should have different canonical forms")
+}
+
+func TestBiMultiMapClear(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Clear()
+
+	assert.Equal(t, []string{}, sut.Keys())
+	assert.Equal(t, []string{}, sut.Values())
+}
+
+func TestBiMultiMapMerge(t *testing.T) {
+	map1 := biMultiMapWithMultipleKeysValues()
+
+	map2 := New[string, string]()
+	map2.Add("key1", "value3")
+	map2.Add("key3", "value3")
+	map2.Add("key1", "value1")
+	map2.Add("key3", "value1")
+	map2.Add("key4", "value4")
+
+	sut := map1.Merge(map2)
+
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3", "key4"}, sut.Keys())
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key1"))
+	assert.ElementsMatch(t, []string{"value1", "value3"}, sut.LookupKey("key3"))
+	assert.ElementsMatch(t, []string{"value4"}, sut.LookupKey("key4"))
+
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3", "value4"}, sut.Values())
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.LookupValue("value1"))
+	assert.ElementsMatch(t, []string{"key1", "key3"}, sut.LookupValue("value3"))
+	assert.ElementsMatch(t, []string{"key4"}, sut.LookupValue("value4"))
+}
+
+func TestBiMultiMapEstimatedBytes(t *testing.T) {
+	sut := New[string, string]()
+	previous := sut.EstimatedBytes()
+	assert.Greater(t, previous, 0, "an empty map should still have a non-zero size")
+
+	for i := 0; i < 10; i++ {
+		sut.Add(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		current := sut.EstimatedBytes()
+		assert.Greater(t, current, previous, "the estimate should grow as pairs are added")
+		previous = current
+	}
+}
+
+func TestBiMultiMapSliceStats(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	forwardSlices, inverseSlices, forwardCap, inverseCap := sut.SliceStats()
+	assert.Equal(t, 2, forwardSlices, "there should be one forward slice per key")
+	assert.Equal(t, 2, inverseSlices, "there should be one inverse slice per value")
+	assert.GreaterOrEqual(t, forwardCap, 4, "the forward capacity should be at least the number of pairs")
+	assert.GreaterOrEqual(t, inverseCap, 4, "the inverse capacity should be at least the number of pairs")
+
+	for cycle := 0; cycle < 3; cycle++ {
+		for i := 0; i < 100; i++ {
+			sut.Add("key1", fmt.Sprintf("extra%d", i))
+		}
+		for i := 0; i < 100; i++ {
+			sut.DeleteKeyValue("key1", fmt.Sprintf("extra%d", i))
+		}
+	}
+
+	forwardSlices, _, grownCap, _ := sut.SliceStats()
+	assert.Equal(t, 2, forwardSlices, "the deleted values should not leave slices behind")
+	assert.Greater(t, grownCap, forwardCap, "deleting values should keep the capacity they used")
+	assert.GreaterOrEqual(t, grownCap, 100, "the capacity should reflect the largest size of the slice")
+}
+
+func TestBiMultiMapCompactAndReport(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	for i := 0; i < 100; i++ {
+		sut.Add("key1", fmt.Sprintf("extra%d", i))
+	}
+	for i := 0; i < 100; i++ {
+		sut.DeleteKeyValue("key1", fmt.Sprintf("extra%d", i))
+	}
+	_, _, forwardCap, _ := sut.SliceStats()
+
+	assert.Positive(t, sut.CompactAndReport(), "compacting should release the capacity left by the deleted values")
+
+	_, _, compactedCap, _ := sut.SliceStats()
+	assert.Less(t, compactedCap, forwardCap, "the capacity should be reduced")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "the values should be kept")
+	assert.Zero(t, sut.CompactAndReport(), "compacting again should not release anything")
+}
+
+func TestBiMultiMapKeyEquivalenceClasses(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	classes := sut.KeyEquivalenceClasses()
+
+	assert.Len(t, classes, 2, "keys with identical value sets should share a class")
+	for _, class := range classes {
+		if len(class) == 2 {
+			assert.ElementsMatch(t, []string{"key1", "key2"}, class, "key1 and key2 have the same values")
+		} else {
+			assert.Equal(t, []string{"key3"}, class, "key3 should be in a class of its own")
+		}
+	}
+}
+
+func TestBiMultiMapKeyEquivalenceClassesMultiset(t *testing.T) {
+	sut := NewMultiset[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key2", "value1")
+	sut.Add("key2", "value1")
+	sut.Add("key2", "value2")
+
+	assert.Len(t, sut.KeyEquivalenceClasses(), 1, "keys with the same set of values should share a class regardless of multiplicity")
+}
+
+func TestBiMultiMapKeysByDegree(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+	sut.Add("key4", "value1")
+	sut.Add("key5", "value1")
+	sut.Add("key5", "value2")
+	sut.Add("key5", "value3")
+
+	groups := sut.KeysByDegree()
+
+	assert.Len(t, groups, 3, "there should be one group per distinct degree")
+	assert.ElementsMatch(t, []string{"key3", "key4"}, groups[1], "key3 and key4 have one value each")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, groups[2], "key1 and key2 have two values each")
+	assert.ElementsMatch(t, []string{"key5"}, groups[3], "key5 has three values")
+}
+
+func TestBiMultiMapKeySummary(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	summary := sut.KeySummary()
+	assert.Equal(t, map[string]int{"key1": 2, "key2": 2}, summary, "every key should be mapped to its number of values")
+
+	sut.Add("key1", "value3")
+	sut.DeleteKey("key2")
+	assert.Equal(t, map[string]int{"key1": 2, "key2": 2}, summary, "a summary should not change with the map")
+	assert.Equal(t, map[string]int{"key1": 3}, sut.KeySummary(), "a new summary should reflect the changes")
+}
+
+func TestBiMultiMapWithKeyDegreeBetween(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value1")
+	sut.Add("key4", "value1")
+	sut.Add("key4", "value2")
+	sut.Add("key4", "value3")
+
+	res := sut.WithKeyDegreeBetween(2, 2)
+
+	assert.ElementsMatch(t, []string{"key1", "key2"}, res.Keys(), "only the keys with two values should be kept")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, res.LookupKey("key1"), "the values of the kept keys should be copied")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, res.LookupValue("value1"), "the inverse should only contain the kept keys")
+	assert.False(t, res.ValueExists("value3"), "values of dropped keys should not be in the inverse")
+	assert.Len(t, sut.WithKeyDegreeBetween(1, 3).Keys(), 4, "every key should be kept if the range covers all degrees")
+	assert.Empty(t, sut.WithKeyDegreeBetween(3, 1).Keys(), "an empty range should keep no keys")
+}
+
+func TestBiMultiMapKeySimilarity(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	assert.Equal(t, 1.0, sut.KeySimilarity("key1", "key2"), "keys with identical values should have a similarity of 1")
+	assert.Equal(t, 0.0, sut.KeySimilarity("key1", "key3"), "a nonexistent key should have a similarity of 0")
+
+	sut = New[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key2", "value2")
+	sut.Add("key2", "value3")
+	sut.Add("key3", "value4")
+
+	assert.InDelta(t, 1.0/3.0, sut.KeySimilarity("key1", "key2"), 1e-9, "one shared value out of three should give 1/3")
+	assert.Equal(t, 0.0, sut.KeySimilarity("key1", "key3"), "keys without shared values should have a similarity of 0")
+}
+
+func TestBiMultiMapValueCoOccurrence(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key2", "value2")
+	sut.Add("key2", "value1")
+	sut.Add("key2", "value3")
+	sut.Add("key3", "value4")
+
+	counts := sut.ValueCoOccurrence()
+	count := func(a, b string) int {
+		return counts[Pair[string, string]{Key: a, Value: b}] + counts[Pair[string, string]{Key: b, Value: a}]
+	}
+
+	assert.Equal(t, 2, count("value1", "value2"), "value1 and value2 co-occur under two keys")
+	assert.Equal(t, 1, count("value1", "value3"), "value1 and value3 co-occur under one key")
+	assert.Equal(t, 1, count("value2", "value3"), "value2 and value3 co-occur under one key")
+	assert.Len(t, counts, 3, "values that never co-occur should be omitted")
+}
+
+func TestBiMultiMapValueCoOccurrenceOrder(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		sut := New[string, string]()
+		sut.Add("key1", "b")
+		sut.Add("key1", "a")
+		sut.Add("key2", "a")
+		sut.Add("key2", "b")
+
+		counts := sut.ValueCoOccurrence()
+		assert.Equal(t, map[Pair[string, string]]int{{Key: "a", Value: "b"}: 2}, counts, "the pair should always have the smaller value as its key")
+	}
+}
+
+func TestBiMultiMapMissingPairs(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value2")
+	sut.Add("key2", "value3")
+
+	missing := sut.MissingPairs([]string{"key1", "key2", "key3"}, []string{"value1", "value2"})
+
+	assert.Equal(t, []Pair[string, string]{
+		{Key: "key1", Value: "value2"},
+		{Key: "key2", Value: "value1"},
+		{Key: "key3", Value: "value1"},
+		{Key: "key3", Value: "value2"},
+	}, missing, "every unassociated combination should be returned")
+}
+
+func TestBiMultiMapCrossCount(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	expected := len(sut.LookupKey("key1")) + len(sut.LookupKey("key3"))
+	assert.Equal(t, expected, sut.CrossCount("key1", "key3"), "CrossCount should sum the degrees of the keys")
+	assert.Equal(t, 2, sut.CrossCount("key2", "key4"), "nonexistent keys should not count")
+	assert.Equal(t, 0, sut.CrossCount(), "no keys should count as zero")
+}
+
+func TestBiMultiMapCountPairsByBucket(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("apple", "fruit")
+	sut.Add("apple", "red")
+	sut.Add("avocado", "fruit")
+	sut.Add("banana", "fruit")
+
+	counts := sut.CountPairsByBucket(func(key string) string { return key[:1] })
+
+	assert.Equal(t, map[string]int{"a": 3, "b": 1}, counts, "pairs should be counted by the first character of their key")
+}
+
+func TestBiMultiMapImpactOfDeleteValue(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value1")
+
+	affected, emptied := sut.ImpactOfDeleteValue("value1")
+	assert.Equal(t, 3, affected, "all keys associated with value1 should be affected")
+	assert.Equal(t, 1, emptied, "only key3 would be left without values")
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.LookupValue("value1"), "the map should not be modified")
+
+	affected, emptied = sut.ImpactOfDeleteValue("value3")
+	assert.Equal(t, 0, affected, "a nonexistent value affects no keys")
+	assert.Equal(t, 0, emptied, "a nonexistent value empties no keys")
+}
+
+func TestBiMultiMapValuesOrphanedByDeletingKey(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key1", "value3")
+
+	assert.Equal(t, []string{"value3"}, sut.ValuesOrphanedByDeletingKey("key1"), "only the value that no other key references should be reported")
+	assert.Empty(t, sut.ValuesOrphanedByDeletingKey("key2"), "shared values should not be reported")
+	assert.Empty(t, sut.ValuesOrphanedByDeletingKey("foo"), "a nonexistent key orphans nothing")
+	assert.True(t, sut.ValueExists("value3"), "the map should not be modified")
+}
+
+func TestBiMultiMapValueNeighborhood(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key2", "value3")
+	sut.Add("key3", "value3")
+
+	neighborhood := sut.ValueNeighborhood("value1")
+
+	assert.Len(t, neighborhood, 2, "both keys of value1 should be returned")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, neighborhood["key1"], "each key should come with all of its values")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, neighborhood["key2"], "each key should come with all of its values")
+	assert.Empty(t, sut.ValueNeighborhood("foo"), "a nonexistent value has no neighborhood")
+
+	neighborhood["key1"][0] = "changed"
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "the values should be copied")
+}
+
+func TestBiMultiMapKeyValuesContainedIn(t *testing.T) {
+	sut := NewRetainingEmptyKeys[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value1")
+	sut.Add("key2", "value2")
+	sut.Add("key3", "value3")
+	sut.ClearKey("key3")
+
+	assert.True(t, sut.KeyValuesContainedIn("key1", "key2"), "the values of key1 are a subset of the values of key2")
+	assert.False(t, sut.KeyValuesContainedIn("key2", "key1"), "the values of key2 are not a subset of the values of key1")
+	assert.False(t, sut.KeyValuesContainedIn("foo", "key1"), "a nonexistent key is not contained in anything")
+	assert.False(t, sut.KeyValuesContainedIn("key1", "foo"), "a key with values is not contained in a nonexistent key")
+	assert.True(t, sut.KeyValuesContainedIn("key3", "key1"), "a key without values is vacuously contained in any key")
+}
+
+func TestBiMultiMapKeysSubsumedBy(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key1", "value3")
+	sut.Add("key3", "value3")
+	sut.Add("key4", "value4")
+
+	assert.ElementsMatch(t, []string{"key2", "key3"}, sut.KeysSubsumedBy("key1"), "keys whose values are a subset of key1's should be returned")
+	assert.ElementsMatch(t, []string{}, sut.KeysSubsumedBy("key2"), "key1 has more values than key2, so it is not subsumed")
+	assert.ElementsMatch(t, []string{}, sut.KeysSubsumedBy("key5"), "a nonexistent key subsumes nothing")
+}
+
+func TestBiMultiMapMaxDisjointKeys(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key1", "value3")
+	sut.Add("key2", "value1")
+	sut.Add("key3", "value2")
+	sut.Add("key4", "value4")
+	sut.Add("key5", "value4")
+
+	res := sut.MaxDisjointKeys()
+
+	seen := make(map[string]string)
+	for _, k := range res {
+		for _, v := range sut.LookupKey(k) {
+			other, found := seen[v]
+			assert.False(t, found, "%s and %s should not share %s", other, k, v)
+			seen[v] = k
+		}
+	}
+	assert.Len(t, res, 3, "key2, key3 and one of key4 and key5 should be picked over key1")
+	assert.Contains(t, res, "key2", "the key with fewer values should be preferred")
+	assert.Contains(t, res, "key3", "the key with fewer values should be preferred")
+	assert.Empty(t, New[string, string]().MaxDisjointKeys(), "an empty map has no keys")
+}
+
+func TestBiMultiMapIsBijection(t *testing.T) {
+	sut := New[string, string]()
+	assert.True(t, sut.IsBijection(), "an empty map is a bijection")
+
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value2")
+	assert.True(t, sut.IsBijection(), "a one-to-one map is a bijection")
+
+	sut.Add("key3", "value2")
+	assert.False(t, sut.IsBijection(), "a value with two keys is not a bijection")
+
+	assert.False(t, biMultiMapWithMultipleKeysValues().IsBijection(), "a many-to-many map is not a bijection")
+}
+
+func TestBiMultiMapEqual(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	same := New[string, string]()
+	same.Add("key2", "value2")
+	same.Add("key2", "value1")
+	same.Add("key1", "value2")
+	same.Add("key1", "value1")
+	assert.True(t, sut.Equal(same), "maps with the same pairs in a different order should be equal")
+	assert.True(t, same.Equal(sut), "equality should be symmetric")
+	assert.True(t, sut.Equal(sut), "a map should be equal to itself")
+
+	otherKeys := biMultiMapWithMultipleKeysValues()
+	otherKeys.Add("key3", "value1")
+	assert.False(t, sut.Equal(otherKeys), "maps with different keys should not be equal")
+	assert.False(t, otherKeys.Equal(sut), "maps with different keys should not be equal")
+
+	otherValues := biMultiMapWithMultipleKeysValues()
+	otherValues.DeleteKeyValue("key1", "value2")
+	otherValues.Add("key1", "value3")
+	assert.False(t, sut.Equal(otherValues), "maps with the same keys but different values should not be equal")
+
+	assert.False(t, sut.Equal(New[string, string]()), "a map should not be equal to an empty map")
+	assert.True(t, New[string, string]().Equal(New[string, string]()), "empty maps should be equal")
+}
+
+func TestBiMultiMapContainsAll(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	sub := New[string, string]()
+	sub.Add("key1", "value1")
+	sub.Add("key2", "value2")
+
+	assert.True(t, sut.ContainsAll(sub), "every pair of the submap is in the map")
+	assert.True(t, sut.ContainsAll(New[string, string]()), "every map contains the empty map")
+	assert.True(t, sut.ContainsAll(sut), "every map contains itself")
+
+	sub.Add("key1", "value3")
+	assert.False(t, sut.ContainsAll(sub), "the map does not contain key1/value3")
+	assert.False(t, sub.ContainsAll(sut), "the submap does not contain all pairs of the map")
+}
+
+func TestBiMultiMapUnionPairCount(t *testing.T) {
+	map1 := biMultiMapWithMultipleKeysValues()
+
+	map2 := New[string, string]()
+	map2.Add("key1", "value1")
+	map2.Add("key2", "value3")
+	map2.Add("key3", "value1")
+
+	// |A| + |B| - |A ∩ B| = 4 + 3 - 1
+	assert.Equal(t, 6, map1.UnionPairCount(map2), "shared pairs should only be counted once")
+	assert.Equal(t, 6, map2.UnionPairCount(map1), "the count should be symmetric")
+	assert.Equal(t, 4, map1.UnionPairCount(map1), "the union of a map with itself is the map")
+}
+
+func TestBiMultiMapKeysValuesNotIn(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	other := New[string, string]()
+	other.Add("key3", "value1")
+	other.Add("key4", "value2")
+
+	assert.ElementsMatch(t, []string{"value3"}, sut.ValuesNotIn(other), "only the extra value should be returned")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.KeysNotIn(other), "only the keys missing from the other map should be returned")
+	assert.ElementsMatch(t, []string{}, other.ValuesNotIn(sut), "every value of the other map is in this one")
+	assert.ElementsMatch(t, []string{}, sut.ValuesNotIn(sut), "comparing a map to itself should not deadlock")
+}
+
+func TestBiMultiMapKeysChangedFrom(t *testing.T) {
+	baseline := biMultiMapWithMultipleKeysValues()
+	baseline.Add("key3", "value3")
+	baseline.Add("key4", "value4")
+
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key1", "value3")
+	sut.Add("key3", "value3")
+	sut.Add("key5", "value5")
+
+	assert.ElementsMatch(t, []string{"key1", "key4", "key5"}, sut.KeysChangedFrom(baseline), "changed, removed and added keys should be reported")
+	assert.Empty(t, sut.KeysChangedFrom(sut), "a map should not differ from itself")
+}
+
+func TestBiMultiMapKeysChangedFromMultiset(t *testing.T) {
+	baseline := NewMultiset[string, string]()
+	baseline.Add("key", "a")
+	baseline.Add("key", "b")
+
+	sut := NewMultiset[string, string]()
+	sut.Add("key", "a")
+	sut.Add("key", "a")
+
+	assert.Equal(t, []string{"key"}, sut.KeysChangedFrom(baseline), "a key whose set of values changed should be reported")
+	assert.Equal(t, []string{"key"}, baseline.KeysChangedFrom(sut), "the comparison should be symmetric")
+}
+
+func TestBiMultiMapValuesByPopularity(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value1")
+	sut.Add("key3", "value4")
+	sut.Add("key4", "value3")
+
+	assert.Equal(t, []string{"value1", "value2", "value3", "value4"}, sut.ValuesByPopularity(), "values should be sorted by number of keys, then by value")
+}
+
+func TestBiMultiMapClone(t *testing.T) {
+	original := biMultiMapWithMultipleKeysValues()
+	sut := original.Clone()
+
+	assert.ElementsMatch(t, original.Keys(), sut.Keys(), "the clone should have the same keys")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "the clone should have the same values")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value1"), "the clone should have the same inverse")
+
+	sut.Add("key1", "value3")
+	sut.DeleteKey("key2")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, original.LookupKey("key1"), "changing the clone should not affect the original")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, original.LookupValue("value1"), "changing the clone should not affect the original")
+	assert.False(t, original.ValueExists("value3"), "changing the clone should not affect the original")
+
+	original.Add("key3", "value3")
+	original.DeleteKeyValue("key1", "value1")
+	assert.False(t, sut.KeyExists("key3"), "changing the original should not affect the clone")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key1"), "changing the original should not affect the clone")
+	assert.ElementsMatch(t, []string{"key1"}, sut.LookupValue("value3"), "changing the original should not affect the clone")
+}
+
+func TestBiMultiMapCloneKeepsMode(t *testing.T) {
+	original := NewMultiset[string, string]()
+	original.Add("key", "value")
+
+	sut := original.Clone()
+	sut.Add("key", "value")
+
+	assert.Equal(t, []string{"value", "value"}, sut.LookupKey("key"), "a clone of a multiset should be a multiset")
+	assert.Equal(t, []string{"value"}, original.LookupKey("key"), "the original should not be affected")
+}
+
+func TestBiMultiMapRemap(t *testing.T) {
+	sut := New[string, int]()
+	sut.Add("numbers", 1)
+	sut.Add("numbers", 2)
+	sut.Add("numbers", 3)
+	sut.Add("other", 1)
+
+	res := sut.Remap(func(_ string, values []int) []Pair[string, int] {
+		pairs := make([]Pair[string, int], 0, len(values))
+		for _, v := range values {
+			if v%2 == 0 {
+				pairs = append(pairs, Pair[string, int]{Key: "even", Value: v})
+			} else {
+				pairs = append(pairs, Pair[string, int]{Key: "odd", Value: v})
+			}
+		}
+		return pairs
+	})
+
+	assert.ElementsMatch(t, []string{"even", "odd"}, res.Keys(), "the key should be split in two and the other one merged")
+	assert.ElementsMatch(t, []int{2}, res.LookupKey("even"), "the even values should go to one key")
+	assert.ElementsMatch(t, []int{1, 3}, res.LookupKey("odd"), "the odd values should go to the other key without duplicates")
+	assert.ElementsMatch(t, []string{"odd"}, res.LookupValue(1), "the inverse should be built from the new pairs")
+	assert.ElementsMatch(t, []int{1, 2, 3}, sut.LookupKey("numbers"), "the source map should not be modified")
+}
+
+func TestBiMultiMapOverlay(t *testing.T) {
+	base := biMultiMapWithMultipleKeysValues()
+
+	top := New[string, string]()
+	top.Add("key1", "value3")
+	top.Add("key3", "value1")
+
+	sut := base.Overlay(top)
+
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.Keys())
+	assert.ElementsMatch(t, []string{"value3"}, sut.LookupKey("key1"), "a shared key should only have the top map's values")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key2"), "a key only in the base map should pass through")
+	assert.ElementsMatch(t, []string{"value1"}, sut.LookupKey("key3"), "a key only in the top map should be added")
+	assert.ElementsMatch(t, []string{"key2", "key3"}, sut.LookupValue("value1"), "the inverse should be consistent")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, base.LookupKey("key1"), "the base map should not be modified")
+}
+
+func TestBiMultiMapSymmetricDifference(t *testing.T) {
+	a := New[string, string]()
+	a.Add("key1", "value1")
+	a.Add("key2", "value2")
+
+	b := New[string, string]()
+	b.Add("key1", "value1")
+	b.Add("key2", "value3")
+
+	sut := a.SymmetricDifference(b)
+
+	assert.ElementsMatch(t, []string{"key2"}, sut.Keys(), "only the key of the unique pairs should remain")
+	assert.ElementsMatch(t, []string{"value2", "value3"}, sut.LookupKey("key2"), "the unique pair of each map should be kept")
+	assert.False(t, sut.ValueExists("value1"), "the shared pair should be dropped")
+	assert.Empty(t, a.SymmetricDifference(a).Keys(), "a map has no difference with itself")
+}
+
+func TestBiMultiMapMergeIntoReturningAdded(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	other := New[string, string]()
+	other.Add("key1", "value1")
+	other.Add("key1", "value3")
+	other.Add("key3", "value2")
+
+	added := sut.MergeIntoReturningAdded(other)
+
+	assert.ElementsMatch(t, []Pair[string, string]{
+		{Key: "key1", Value: "value3"},
+		{Key: "key3", Value: "value2"},
+	}, added, "only the pairs that were not already present should be returned")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key1"), "the pairs should be merged into the map")
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.LookupValue("value2"), "the inverse should be updated")
+	assert.ElementsMatch(t, []string{"key1", "key3"}, other.Keys(), "the other map should not be modified")
+	assert.Empty(t, sut.MergeIntoReturningAdded(sut), "merging a map into itself adds nothing")
+}
+
+func TestBiMultiMapMergeIntoReturningAddedValidated(t *testing.T) {
+	sut := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	})
+
+	other := New[string, string]()
+	other.Add("x", "")
+	other.Add("x", "value1")
+
+	added := sut.MergeIntoReturningAdded(other)
+
+	assert.Equal(t, []Pair[string, string]{{Key: "x", Value: "value1"}}, added, "rejected pairs should not be returned")
+	assert.Equal(t, []string{"value1"}, sut.LookupKey("x"), "rejected pairs should not be stored")
+}
+
+func TestMergeAll(t *testing.T) {
+	map1 := biMultiMapWithMultipleKeysValues()
+
+	map2 := New[string, string]()
+	map2.Add("key1", "value1")
+	map2.Add("key3", "value3")
+
+	map3 := New[string, string]()
+	map3.Add("key3", "value3")
+	map3.Add("key3", "value1")
+	map3.Add("key4", "value2")
+
+	sut := MergeAll(map1, map2, map3)
+
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3", "key4"}, sut.Keys())
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"))
+	assert.ElementsMatch(t, []string{"value1", "value3"}, sut.LookupKey("key3"))
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key4"))
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.LookupValue("value1"))
+	assert.ElementsMatch(t, []string{"key3"}, sut.LookupValue("value3"))
+}
+
+func TestMergeValuesWith(t *testing.T) {
+	a := biMultiMapWithMultipleKeysValues()
+	a.Add("key3", "value3")
+	b := New[string, string]()
+	b.Add("key1", "value2")
+	b.Add("key1", "value4")
+	b.Add("key2", "value4")
+	b.Add("key4", "value4")
+
+	union := MergeValuesWith(a, b, func(existing, incoming []string) []string {
+		return append(existing, incoming...)
+	})
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3", "key4"}, union.Keys(), "the keys of both maps should be kept")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value4"}, union.LookupKey("key1"), "the union should be deduplicated")
+	assert.ElementsMatch(t, []string{"value3"}, union.LookupKey("key3"), "keys only in a should keep their values")
+	assert.ElementsMatch(t, []string{"key1", "key2", "key4"}, union.LookupValue("value4"), "the inverse should be consistent")
+
+	intersection := MergeValuesWith(a, b, func(existing, incoming []string) []string {
+		res := make([]string, 0)
+		for _, v := range existing {
+			if slices.Contains(incoming, v) {
+				res = append(res, v)
+			}
+		}
+		return res
+	})
+	assert.ElementsMatch(t, []string{"value2"}, intersection.LookupKey("key1"), "only the shared values should be kept")
+	assert.False(t, intersection.KeyExists("key2"), "a key with no shared values should be left out")
+	assert.ElementsMatch(t, []string{"value4"}, intersection.LookupKey("key4"), "keys only in b should keep their values")
+}
+
+func TestMergeAllEmpty(t *testing.T) {
+	sut := MergeAll[string, string]()
+
+	assert.NotNil(t, sut, "merging no maps should return a map")
+	assert.Empty(t, sut.Keys(), "merging no maps should return an empty map")
+}
+
+func TestMergeTracked(t *testing.T) {
+	a := biMultiMapWithMultipleKeysValues()
+	b := New[string, string]()
+	b.Add("key1", "value1")
+	b.Add("key3", "value3")
+
+	sut, provenance := MergeTracked(map[string]*BiMultiMap[string, string]{"a": a, "b": b})
+
+	assert.ElementsMatch(t, []string{"key1", "key2", "key3"}, sut.Keys(), "all keys should be merged")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "shared pairs should not be duplicated")
+	assert.Equal(t, []string{"a", "b"}, provenance[Pair[string, string]{Key: "key1", Value: "value1"}], "a shared pair should list both sources")
+	assert.Equal(t, []string{"a"}, provenance[Pair[string, string]{Key: "key2", Value: "value2"}], "a pair should list only the sources that contain it")
+	assert.Equal(t, []string{"b"}, provenance[Pair[string, string]{Key: "key3", Value: "value3"}], "a pair should list only the sources that contain it")
+	assert.Len(t, provenance, 5, "every merged pair should have a provenance")
+}
+
+func TestBiMultiMapSharedValues(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key1", "value3")
+
+	other := New[string, string]()
+	other.Add("key1", "value2")
+	other.Add("key1", "value3")
+	other.Add("key1", "value4")
+	other.Add("key2", "value1")
+
+	assert.Equal(t, []string{"value2", "value3"}, sut.SharedValues(other, "key1"), "only the overlap should be returned")
+	assert.Equal(t, []string{}, sut.SharedValues(other, "key3"), "a nonexistent key has no shared values")
+}
+
+func TestBiMultiMapOrphans(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key3", "value3")
+
+	orphanKeys := sut.OrphanKeys(map[string]struct{}{"key1": {}, "key2": {}, "key4": {}})
+	orphanValues := sut.OrphanValues(map[string]struct{}{"value1": {}, "value2": {}, "value3": {}})
+
+	assert.ElementsMatch(t, []string{"key3"}, orphanKeys, "a key missing from the valid set should be an orphan")
+	assert.ElementsMatch(t, []string{}, orphanValues, "all values are valid")
+	assert.ElementsMatch(t, []string{"value1", "value2", "value3"}, sut.OrphanValues(nil), "every value is an orphan when nothing is valid")
+}
+
+func biMultiMapWithMultipleKeysValues() *BiMultiMap[string, string] {
+	m := New[string, string]()
+	m.Add("key1", "value1")
+	m.Add("key1", "value2")
+	m.Add("key2", "value1")
+	m.Add("key2", "value2")
+
+	return m
+}
+
+func BenchmarkDeleteKeyValue(b *testing.B) {
+	benchmarkChurn(b, New[string, int])
+}
+
+func BenchmarkDeleteKeyValueAutoCompacting(b *testing.B) {
+	benchmarkChurn(b, NewAutoCompacting[string, int])
+}
+
+func benchmarkChurn(b *testing.B, newMap func() *BiMultiMap[string, int]) {
+	for i := 0; i < b.N; i++ {
+		m := newMap()
+		for j := 0; j < 1000; j++ {
+			m.Add("key", j)
+		}
+		for j := 0; j < 990; j++ {
+			m.DeleteKeyValue("key", j)
+		}
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	benchmarkBulkAdd(b, func(m *BiMultiMap[int, int]) {
+		for j := 0; j < 1000; j++ {
+			m.Add(j/10, j)
+		}
+	})
+}
+
+func BenchmarkAddMany(b *testing.B) {
+	values := make([][]int, 100)
+	for j := 0; j < 1000; j++ {
+		values[j/10] = append(values[j/10], j)
+	}
+
+	benchmarkBulkAdd(b, func(m *BiMultiMap[int, int]) {
+		for k, vs := range values {
+			m.AddMany(k, vs...)
+		}
+	})
+}
+
+func BenchmarkAddAll(b *testing.B) {
+	pairs := func(yield func(int, int) bool) {
+		for j := 0; j < 1000; j++ {
+			if !yield(j/10, j) {
+				return
+			}
+		}
+	}
+
+	benchmarkBulkAdd(b, func(m *BiMultiMap[int, int]) {
+		m.AddAll(pairs)
+	})
+}
+
+// benchmarkBulkAdd measures adding pairs to a map while other goroutines keep reading from it, so
+// that every lock acquisition has to compete with the readers
+func benchmarkBulkAdd(b *testing.B, add func(m *BiMultiMap[int, int])) {
+	for i := 0; i < b.N; i++ {
+		m := New[int, int]()
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						m.KeyExists(r)
+					}
+				}
+			}()
+		}
+
+		add(m)
+
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// The "slice scan" benchmarks reproduce how a pair used to be looked up, by scanning the values of its
+// key, to compare it with the pair index on a key with many values
+func BenchmarkAddHighFanOut(b *testing.B) {
+	b.Run("slice scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := New[int, int]()
+			for j := 0; j < 5000; j++ {
+				m.mutex.Lock()
+				if !containsElement(m.forward[0], j) {
+					m.insert(0, j)
+				}
+				m.unlock()
+			}
+		}
+	})
+	b.Run("pair index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := New[int, int]()
+			for j := 0; j < 5000; j++ {
+				m.Add(0, j)
+			}
+		}
+	})
+}
+
+func BenchmarkContainsHighFanOut(b *testing.B) {
+	m := New[int, int]()
+	for j := 0; j < 5000; j++ {
+		m.Add(0, j)
+	}
+
+	b.Run("slice scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.mutex.RLock()
+			containsElement(m.forward[0], i%5000)
+			m.mutex.RUnlock()
+		}
+	})
+	b.Run("pair index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.Contains(0, i%5000)
+		}
+	})
+}
+
+// Deleting a pair still shifts the remaining values of its key, so this grows with the number of
+// values of the key
+func BenchmarkDeleteKeyValueHighFanOut(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		m := New[int, int]()
+		for j := 0; j < 5000; j++ {
+			m.Add(0, j)
+		}
+		b.StartTimer()
+
+		for j := 0; j < 5000; j++ {
+			m.DeleteKeyValue(0, j)
+		}
+	}
 }
@@ -0,0 +1,78 @@
+package bimultimap
+
+// changeLogSize is the maximum number of changes kept in a map's change history
+const changeLogSize = 1024
+
+// ChangeKind tells whether a Change added or removed a key/value pair
+type ChangeKind int
+
+const (
+	// PairAdded is the kind of a change that added a key/value pair
+	PairAdded ChangeKind = iota
+	// PairRemoved is the kind of a change that removed a key/value pair
+	PairRemoved
+)
+
+// Change describes a single key/value pair being added to or removed from a map
+type Change[K comparable, V comparable] struct {
+	Version uint64
+	Kind    ChangeKind
+	Key     K
+	Value   V
+}
+
+// Version returns the current version of the map. The version is incremented every time a key/value
+// pair is added or removed, and when the map is cleared
+func (m *BiMultiMap[K, V]) Version() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.version
+}
+
+// ChangesSince returns the changes made after the given version, oldest first. Only the most recent
+// changes are kept, and Clear discards the history; the second return value is false if some of the
+// changes since the version are no longer available, in which case no changes are returned
+func (m *BiMultiMap[K, V]) ChangesSince(version uint64) ([]Change[K, V], bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if version < m.historyFrom {
+		return nil, false
+	}
+
+	res := make([]Change[K, V], 0)
+	for i := range m.changes {
+		c := m.changes[(m.changesHead+i)%len(m.changes)]
+		if c.Version > version {
+			res = append(res, c)
+		}
+	}
+	return res, true
+}
+
+// recordChange bumps the version and appends a change to the history. The caller must hold the
+// write lock
+func (m *BiMultiMap[K, V]) recordChange(kind ChangeKind, key K, value V) {
+	m.version++
+	c := Change[K, V]{Version: m.version, Kind: kind, Key: key, Value: value}
+
+	if len(m.changes) < changeLogSize {
+		m.changes = append(m.changes, c)
+		return
+	}
+
+	// The history is full: overwrite the oldest change, after which the history is only complete
+	// starting from the overwritten version
+	m.historyFrom = m.changes[m.changesHead].Version
+	m.changes[m.changesHead] = c
+	m.changesHead = (m.changesHead + 1) % len(m.changes)
+}
+
+// resetChanges bumps the version and discards the history. The caller must hold the write lock
+func (m *BiMultiMap[K, V]) resetChanges() {
+	m.version++
+	m.changes = nil
+	m.changesHead = 0
+	m.historyFrom = m.version
+}
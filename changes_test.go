@@ -0,0 +1,72 @@
+package bimultimap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangesSince(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+
+	version := sut.Version()
+	sut.Add("key2", "value1")
+	sut.Add("key2", "value1")
+	sut.DeleteKeyValue("key1", "value2")
+
+	changes, ok := sut.ChangesSince(version)
+
+	assert.True(t, ok, "the history should cover the version")
+	assert.Equal(t, []Change[string, string]{
+		{Version: version + 1, Kind: PairAdded, Key: "key2", Value: "value1"},
+		{Version: version + 2, Kind: PairRemoved, Key: "key1", Value: "value2"},
+	}, changes, "only the changes after the version should be returned, and duplicate Adds are not changes")
+	assert.Equal(t, version+2, sut.Version(), "the version should be incremented once per change")
+
+	changes, ok = sut.ChangesSince(sut.Version())
+	assert.True(t, ok, "the history should cover the current version")
+	assert.Empty(t, changes, "there should be no changes since the current version")
+}
+
+func TestChangesSinceDeleteKey(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	version := sut.Version()
+
+	sut.DeleteKey("key1")
+
+	changes, ok := sut.ChangesSince(version)
+	assert.True(t, ok, "the history should cover the version")
+	assert.ElementsMatch(t, []Change[string, string]{
+		{Version: version + 1, Kind: PairRemoved, Key: "key1", Value: "value1"},
+		{Version: version + 2, Kind: PairRemoved, Key: "key1", Value: "value2"},
+	}, changes, "deleting a key should record the removal of each of its pairs")
+}
+
+func TestChangesSinceEvicted(t *testing.T) {
+	sut := New[string, string]()
+	for i := 0; i < changeLogSize+10; i++ {
+		sut.Add("key", fmt.Sprintf("value%d", i))
+	}
+
+	_, ok := sut.ChangesSince(5)
+	assert.False(t, ok, "changes older than the history should be reported as unavailable")
+
+	changes, ok := sut.ChangesSince(10)
+	assert.True(t, ok, "the oldest changes still in the history should be available")
+	assert.Len(t, changes, changeLogSize, "the whole history should be returned")
+	assert.Equal(t, uint64(11), changes[0].Version, "changes should be returned oldest first")
+}
+
+func TestChangesSinceClear(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	version := sut.Version()
+
+	sut.Clear()
+
+	_, ok := sut.ChangesSince(version)
+	assert.False(t, ok, "clearing the map should discard the history")
+	assert.Greater(t, sut.Version(), version, "clearing the map should change the version")
+}
@@ -0,0 +1,80 @@
+package bimultimap
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MarshalJSON encodes the map as a JSON object from each key to an array of its values, e.g.
+// {"key1":["value1","value2"]}. Only the key/value pairs are encoded, not the configuration of the map.
+// Since JSON object keys are strings, K must be a string, an integer type or implement
+// encoding.TextMarshaler
+func (m *BiMultiMap[K, V]) MarshalJSON() ([]byte, error) {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return json.Marshal(m.forward)
+}
+
+// UnmarshalJSON replaces the contents of the map with the key/value pairs encoded by MarshalJSON,
+// rebuilding the inverse index. Pairs rejected by the validator of a map created with NewWithValidator
+// are skipped. The map is left unchanged if the data cannot be decoded
+func (m *BiMultiMap[K, V]) UnmarshalJSON(data []byte) error {
+	var forward map[K][]V
+	if err := json.Unmarshal(data, &forward); err != nil {
+		return err
+	}
+
+	m.replace(forward)
+	return nil
+}
+
+// MarshalMsgpack encodes the map in MessagePack format, as a map from each key to an array of its
+// values. Only the key/value pairs are encoded, not the configuration of the map
+func (m *BiMultiMap[K, V]) MarshalMsgpack() ([]byte, error) {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return msgpack.Marshal(m.forward)
+}
+
+// UnmarshalMsgpack replaces the contents of the map with the key/value pairs encoded by
+// MarshalMsgpack, rebuilding the inverse index. Pairs rejected by the validator of a map created with
+// NewWithValidator are skipped. The map is left unchanged if the data cannot be decoded
+func (m *BiMultiMap[K, V]) UnmarshalMsgpack(data []byte) error {
+	var forward map[K][]V
+	if err := msgpack.Unmarshal(data, &forward); err != nil {
+		return err
+	}
+
+	m.replace(forward)
+	return nil
+}
+
+// replace replaces the contents of the map with the key/value pairs of a decoded forward index,
+// skipping the pairs rejected by the map's validator
+func (m *BiMultiMap[K, V]) replace(forward map[K][]V) {
+	if m.validator != nil {
+		for k, values := range forward {
+			forward[k] = slices.DeleteFunc(values, func(v V) bool {
+				return !m.accepts(k, v)
+			})
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.unlock()
+
+	m.reset()
+	for k, values := range forward {
+		for _, v := range values {
+			m.add(k, v)
+		}
+	}
+}
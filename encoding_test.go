@@ -0,0 +1,140 @@
+package bimultimap
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestBiMultiMapJSONRoundTrip(t *testing.T) {
+	original := biMultiMapWithMultipleKeysValues()
+	original.Add("key3", "value3")
+
+	data, err := json.Marshal(original)
+	assert.NoError(t, err, "encoding should succeed")
+
+	sut := New[string, string]()
+	sut.Add("stale", "stale")
+	err = json.Unmarshal(data, sut)
+	assert.NoError(t, err, "decoding should succeed")
+
+	assert.ElementsMatch(t, original.Keys(), sut.Keys(), "the keys should be restored")
+	for _, k := range original.Keys() {
+		assert.ElementsMatch(t, original.LookupKey(k), sut.LookupKey(k), "the values should be restored")
+	}
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value1"), "a value shared by two keys should be restored in the inverse")
+	assert.False(t, sut.KeyExists("stale"), "the previous contents should be replaced")
+}
+
+func TestBiMultiMapJSONFormat(t *testing.T) {
+	sut := New[string, int]()
+	sut.Add("key", 1)
+	sut.Add("key", 2)
+
+	data, err := json.Marshal(sut)
+	assert.NoError(t, err, "encoding should succeed")
+	assert.JSONEq(t, `{"key":[1,2]}`, string(data), "the forward index should be encoded as an object")
+
+	data, err = json.Marshal(New[string, int]())
+	assert.NoError(t, err, "encoding an empty map should succeed")
+	assert.JSONEq(t, `{}`, string(data), "an empty map should be encoded as an empty object")
+
+	restored := New[string, int]()
+	assert.NoError(t, json.Unmarshal(data, restored), "decoding an empty map should succeed")
+	assert.Zero(t, restored.Size(), "an empty map should be restored as empty")
+
+	var empty BiMultiMap[string, int]
+	assert.NoError(t, json.Unmarshal([]byte(`{"key":[1,1,2]}`), &empty), "decoding into a zero map should succeed")
+	assert.Equal(t, []int{1, 2}, empty.LookupKey("key"), "duplicates should be dropped")
+	assert.Error(t, restored.UnmarshalJSON([]byte(`[1]`)), "invalid data should be rejected")
+}
+
+func TestBiMultiMapUnmarshalJSONValidated(t *testing.T) {
+	sut := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	})
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"key1":["value1",""],"key2":[""]}`), sut), "decoding should succeed")
+	assert.Equal(t, []string{"value1"}, sut.LookupKey("key1"), "rejected pairs should be skipped")
+	assert.False(t, sut.KeyExists("key2"), "a key with only rejected values should not be created")
+	assert.False(t, sut.ValueExists(""), "rejected pairs should be skipped")
+}
+
+func TestBiMultiMapMarshalJSONExpired(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+	sut.Add("key", "value")
+	now = now.Add(time.Minute)
+
+	data, err := json.Marshal(sut)
+	assert.NoError(t, err, "encoding should succeed")
+	assert.JSONEq(t, `{}`, string(data), "expired pairs should not be encoded")
+}
+
+func TestBiMultiMapMsgpackRoundTrip(t *testing.T) {
+	original := biMultiMapWithMultipleKeysValues()
+	original.Add("key3", "value3")
+
+	data, err := msgpack.Marshal(original)
+	assert.NoError(t, err, "encoding should succeed")
+
+	sut := New[string, string]()
+	sut.Add("stale", "stale")
+	err = msgpack.Unmarshal(data, sut)
+	assert.NoError(t, err, "decoding should succeed")
+
+	assert.ElementsMatch(t, original.Keys(), sut.Keys(), "the keys should be restored")
+	for _, k := range original.Keys() {
+		assert.ElementsMatch(t, original.LookupKey(k), sut.LookupKey(k), "the values should be restored")
+	}
+	for _, v := range original.Values() {
+		assert.ElementsMatch(t, original.LookupValue(v), sut.LookupValue(v), "the inverse should be rebuilt")
+	}
+	assert.False(t, sut.KeyExists("stale"), "the previous contents should be replaced")
+}
+
+func TestBiMultiMapUnmarshalMsgpackInvalid(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+
+	err := sut.UnmarshalMsgpack([]byte{0xc1})
+	assert.Error(t, err, "invalid data should be rejected")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "the map should be left unchanged")
+}
+
+func TestBiMultiMapUnmarshalMsgpackValidated(t *testing.T) {
+	data, err := msgpack.Marshal(map[string][]string{"key1": {"value1", ""}, "key2": {""}})
+	assert.NoError(t, err, "encoding should succeed")
+
+	sut := NewWithValidator(func(key string, value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	})
+	assert.NoError(t, msgpack.Unmarshal(data, sut), "decoding should succeed")
+	assert.Equal(t, []string{"value1"}, sut.LookupKey("key1"), "rejected pairs should be skipped")
+	assert.False(t, sut.KeyExists("key2"), "a key with only rejected values should not be created")
+}
+
+func TestBiMultiMapMarshalMsgpackExpired(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+	sut.Add("key1", "value1")
+	now = now.Add(30 * time.Second)
+	sut.Add("key2", "value2")
+	now = now.Add(30 * time.Second)
+
+	data, err := msgpack.Marshal(sut)
+	assert.NoError(t, err, "encoding should succeed")
+
+	restored := New[string, string]()
+	assert.NoError(t, msgpack.Unmarshal(data, restored), "decoding should succeed")
+	assert.Equal(t, []string{"key2"}, restored.Keys(), "expired pairs should not be encoded")
+}
@@ -0,0 +1,485 @@
+package bimultimap
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// The functions in this file treat a BiMultiMap whose keys and values have the same type as a
+// directed graph, with an edge from each key to each of its values. Go does not allow methods to be
+// declared only for some instantiations of a generic type, so they are functions instead of methods
+
+// ErrCycle is returned by graph algorithms that require the graph to be acyclic
+var ErrCycle = errors.New("bimultimap: the graph contains a cycle")
+
+// DFS node states used for cycle detection
+const (
+	unvisited = iota
+	inProgress
+	done
+)
+
+// HasCycle returns true if the graph formed by the map contains a directed cycle, including a
+// self-loop
+func HasCycle[T comparable](m *BiMultiMap[T, T]) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	state := make(map[T]int, len(m.forward))
+
+	var visit func(node T) bool
+	visit = func(node T) bool {
+		state[node] = inProgress
+		for _, next := range m.forward[node] {
+			switch state[next] {
+			case inProgress:
+				return true
+			case unvisited:
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		state[node] = done
+		return false
+	}
+
+	for node := range m.forward {
+		if state[node] == unvisited && visit(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// TopoSort returns the nodes of the graph formed by the map in topological order, so that every key
+// comes before all of its values. It returns ErrCycle if the graph contains a cycle
+func TopoSort[T comparable](m *BiMultiMap[T, T]) ([]T, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return topoSort(m)
+}
+
+// topoSort implements TopoSort. The caller must hold the read or the write lock
+func topoSort[T comparable](m *BiMultiMap[T, T]) ([]T, error) {
+	inverse := m.inverseIndex()
+	inDegree := make(map[T]int, len(m.forward)+len(inverse))
+	for node := range m.forward {
+		inDegree[node] = len(inverse[node])
+	}
+	for node, keys := range inverse {
+		inDegree[node] = len(keys)
+	}
+
+	queue := make([]T, 0, len(inDegree))
+	for node, degree := range inDegree {
+		if degree == 0 {
+			queue = append(queue, node)
+		}
+	}
+
+	res := make([]T, 0, len(inDegree))
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		res = append(res, node)
+
+		for _, next := range m.forward[node] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if len(res) != len(inDegree) {
+		return nil, ErrCycle
+	}
+	return res, nil
+}
+
+// LongestPath returns a path with the most nodes in the graph formed by the map, following edges from
+// keys to values. If there are several longest paths, which one is returned is unspecified. It
+// returns ErrCycle if the graph contains a cycle, since paths could then be arbitrarily long
+func LongestPath[T comparable](m *BiMultiMap[T, T]) ([]T, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	order, err := topoSort(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// length is the number of nodes in the longest path ending at each node, and prev is the node
+	// before it on that path
+	length := make(map[T]int, len(order))
+	prev := make(map[T]T, len(order))
+	var end T
+	best := 0
+	for _, node := range order {
+		length[node] = max(length[node], 1)
+		if length[node] > best {
+			end, best = node, length[node]
+		}
+		for _, next := range m.forward[node] {
+			if length[node]+1 > length[next] {
+				length[next] = length[node] + 1
+				prev[next] = node
+			}
+		}
+	}
+
+	res := make([]T, best)
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = end
+		end = prev[end]
+	}
+	return res, nil
+}
+
+// ComponentCount returns the number of weakly connected components in the graph formed by the map,
+// i.e. edges are followed regardless of their direction
+func ComponentCount[T comparable](m *BiMultiMap[T, T]) int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	parent := make(map[T]T, len(m.forward))
+	var find func(node T) T
+	find = func(node T) T {
+		p, found := parent[node]
+		if !found {
+			parent[node] = node
+			return node
+		}
+		if p == node {
+			return node
+		}
+		root := find(p)
+		parent[node] = root
+		return root
+	}
+
+	components := 0
+	for from, values := range m.forward {
+		if _, found := parent[from]; !found {
+			components++
+		}
+		fromRoot := find(from)
+		for _, to := range values {
+			if _, found := parent[to]; !found {
+				components++
+			}
+			toRoot := find(to)
+			if fromRoot != toRoot {
+				parent[toRoot] = fromRoot
+				components--
+			}
+		}
+	}
+	return components
+}
+
+// ShortestPath returns a path with the fewest edges from one node to another, following edges from
+// keys to values, including both endpoints. The second return value is false if there is no path,
+// which includes the path from a node to itself when the node is not in the map
+func ShortestPath[T comparable](m *BiMultiMap[T, T], from, to T) ([]T, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if from == to {
+		if _, found := m.forward[from]; !found && len(m.keysOf(from)) == 0 {
+			return nil, false
+		}
+		return []T{from}, true
+	}
+
+	previous := map[T]T{from: from}
+	queue := []T{from}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, next := range m.forward[node] {
+			if _, seen := previous[next]; seen {
+				continue
+			}
+			previous[next] = node
+
+			if next == to {
+				path := []T{to}
+				for path[0] != from {
+					path = append([]T{previous[path[0]]}, path...)
+				}
+				return path, true
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil, false
+}
+
+// WriteDOT writes the graph formed by the map in Graphviz DOT format, as a digraph with the given
+// name and one edge per key/value pair. Edges are sorted so that the output is deterministic
+func WriteDOT(m *BiMultiMap[string, string], w io.Writer, name string) error {
+	m.mutex.RLock()
+	keys := make([]string, 0, len(m.forward))
+	for k := range m.forward {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(name))
+	for _, k := range keys {
+		values := slices.Clone(m.forward[k])
+		slices.Sort(values)
+		for _, v := range values {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(k), dotQuote(v))
+		}
+	}
+	b.WriteString("}\n")
+	m.mutex.RUnlock()
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuoter escapes the characters that have a special meaning inside a quoted DOT ID
+var dotQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// dotQuote quotes a string as a DOT ID. Unlike strconv.Quote it leaves non-ASCII and control
+// characters as they are, since DOT does not understand Go escape sequences
+func dotQuote(s string) string {
+	return `"` + dotQuoter.Replace(s) + `"`
+}
+
+// Identity returns all nodes that have an edge to themselves, in no particular order
+func Identity[T comparable](m *BiMultiMap[T, T]) []T {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := make([]T, 0)
+	for node, values := range m.forward {
+		if slices.Contains(values, node) {
+			res = append(res, node)
+		}
+	}
+	return res
+}
+
+// WithoutSelfLoops returns a new map containing all of the map's edges except the ones that go from a
+// node to itself
+func WithoutSelfLoops[T comparable](m *BiMultiMap[T, T]) *BiMultiMap[T, T] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := New[T, T]()
+	for from, values := range m.forward {
+		for _, to := range values {
+			if from != to {
+				res.add(from, to)
+			}
+		}
+	}
+	return res
+}
+
+// Bridges returns the edges whose removal would increase the number of weakly connected components
+// of the graph formed by the map. Edge directions are ignored, so a pair of opposite edges between
+// two nodes is never a bridge, and neither are self-loops
+func Bridges[T comparable](m *BiMultiMap[T, T]) []Pair[T, T] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	type halfEdge struct {
+		to T
+		id int
+	}
+
+	edges := make([]Pair[T, T], 0)
+	adjacent := make(map[T][]halfEdge)
+	for from, values := range m.forward {
+		for _, to := range values {
+			if from == to {
+				continue
+			}
+			id := len(edges)
+			edges = append(edges, Pair[T, T]{Key: from, Value: to})
+			adjacent[from] = append(adjacent[from], halfEdge{to: to, id: id})
+			adjacent[to] = append(adjacent[to], halfEdge{to: from, id: id})
+		}
+	}
+
+	// Tarjan's bridge-finding algorithm. The edge used to reach a node is skipped by id rather than
+	// by node so that parallel edges are handled correctly
+	discovered := make(map[T]int, len(adjacent))
+	low := make(map[T]int, len(adjacent))
+	res := make([]Pair[T, T], 0)
+
+	var visit func(node T, viaEdge int)
+	visit = func(node T, viaEdge int) {
+		discovered[node] = len(discovered) + 1
+		low[node] = discovered[node]
+
+		for _, e := range adjacent[node] {
+			if e.id == viaEdge {
+				continue
+			}
+			if _, seen := discovered[e.to]; seen {
+				low[node] = min(low[node], discovered[e.to])
+				continue
+			}
+
+			visit(e.to, e.id)
+			low[node] = min(low[node], low[e.to])
+			if low[e.to] > discovered[node] {
+				res = append(res, edges[e.id])
+			}
+		}
+	}
+
+	for node := range adjacent {
+		if _, seen := discovered[node]; !seen {
+			visit(node, -1)
+		}
+	}
+	return res
+}
+
+// MaximalCliques returns all maximal cliques of the graph formed by the map, i.e. the sets of nodes
+// that are all connected to each other and cannot be extended with another node. Edge directions are
+// ignored and self-loops are skipped, so a node without edges to other nodes forms a clique of its
+// own. Neither the cliques nor the nodes inside them are ordered. It uses the Bron-Kerbosch algorithm
+// with pivoting, which can take exponential time on large dense graphs
+func MaximalCliques[T comparable](m *BiMultiMap[T, T]) [][]T {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	adjacent := make(map[T]map[T]struct{})
+	addNode := func(node T) {
+		if _, found := adjacent[node]; !found {
+			adjacent[node] = make(map[T]struct{})
+		}
+	}
+	for from, values := range m.forward {
+		addNode(from)
+		for _, to := range values {
+			addNode(to)
+			if from != to {
+				adjacent[from][to] = struct{}{}
+				adjacent[to][from] = struct{}{}
+			}
+		}
+	}
+
+	neighborsIn := func(node T, set map[T]struct{}) map[T]struct{} {
+		res := make(map[T]struct{})
+		for n := range adjacent[node] {
+			if _, found := set[n]; found {
+				res[n] = struct{}{}
+			}
+		}
+		return res
+	}
+
+	res := make([][]T, 0)
+	var extend func(clique []T, candidates, excluded map[T]struct{})
+	extend = func(clique []T, candidates, excluded map[T]struct{}) {
+		if len(candidates) == 0 {
+			if len(excluded) == 0 && len(clique) > 0 {
+				res = append(res, slices.Clone(clique))
+			}
+			return
+		}
+
+		// Only the pivot and the candidates that are not its neighbors need to be tried, since any
+		// maximal clique either contains the pivot or a node that is not adjacent to it
+		var pivot T
+		best := -1
+		for _, set := range []map[T]struct{}{candidates, excluded} {
+			for node := range set {
+				if n := len(neighborsIn(node, candidates)); n > best {
+					pivot, best = node, n
+				}
+			}
+		}
+
+		for node := range candidates {
+			if _, found := adjacent[pivot][node]; found {
+				continue
+			}
+			extend(append(clique, node), neighborsIn(node, candidates), neighborsIn(node, excluded))
+			delete(candidates, node)
+			excluded[node] = struct{}{}
+		}
+	}
+
+	candidates := make(map[T]struct{}, len(adjacent))
+	for node := range adjacent {
+		candidates[node] = struct{}{}
+	}
+	extend(nil, candidates, make(map[T]struct{}))
+	return res
+}
+
+// ReverseEdge replaces the edge from -> to with the edge to -> from in a single atomic operation. It
+// returns false and leaves the map unchanged if there is no edge from -> to. If the reversed edge
+// already exists the two are merged
+func ReverseEdge[T comparable](m *BiMultiMap[T, T], from, to T) bool {
+	m.mutex.Lock()
+	defer m.unlock()
+
+	if !m.deleteKeyValue(from, to) {
+		return false
+	}
+	m.add(to, from)
+	return true
+}
+
+// UndirectedCanonical returns a new map where each edge of the graph formed by this map appears only
+// once regardless of its direction, going from the smaller node to the larger one. This collapses a
+// symmetric relation stored as both a -> b and b -> a into a single edge
+func UndirectedCanonical[T cmp.Ordered](m *BiMultiMap[T, T]) *BiMultiMap[T, T] {
+	return UndirectedCanonicalFunc(m, cmp.Less[T])
+}
+
+// UndirectedCanonicalFunc is like UndirectedCanonical, but uses less to order the nodes. less must
+// be a strict weak ordering in which no two distinct nodes are equivalent
+func UndirectedCanonicalFunc[T comparable](m *BiMultiMap[T, T], less func(a, b T) bool) *BiMultiMap[T, T] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	res := New[T, T]()
+	for from, values := range m.forward {
+		for _, to := range values {
+			if less(to, from) {
+				res.add(to, from)
+			} else {
+				res.add(from, to)
+			}
+		}
+	}
+	return res
+}
+
+// DegreeCentrality returns the total degree of every node in the graph formed by the map, i.e. the
+// number of outgoing edges plus the number of incoming edges. A self-loop counts twice
+func DegreeCentrality[T comparable](m *BiMultiMap[T, T]) map[T]int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	inverse := m.inverseIndex()
+	res := make(map[T]int, len(m.forward)+len(inverse))
+	for node, values := range m.forward {
+		res[node] += len(values)
+	}
+	for node, keys := range inverse {
+		res[node] += len(keys)
+	}
+	return res
+}
@@ -0,0 +1,303 @@
+package bimultimap
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasCycleAcyclic(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("a", "c")
+
+	assert.False(t, HasCycle(sut), "a chain should not have a cycle")
+}
+
+func TestHasCycleSelfLoop(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("b", "b")
+
+	assert.True(t, HasCycle(sut), "a self-loop is a cycle")
+}
+
+func TestHasCycleMultiNode(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("c", "d")
+	sut.Add("d", "b")
+
+	assert.True(t, HasCycle(sut), "b -> c -> d -> b is a cycle")
+}
+
+func TestTopoSort(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("a", "c")
+	sut.Add("b", "d")
+	sut.Add("c", "d")
+	sut.Add("d", "e")
+
+	order, err := TopoSort(sut)
+
+	assert.NoError(t, err, "a DAG should be sortable")
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, order, "every node should be in the result")
+	position := make(map[string]int, len(order))
+	for i, node := range order {
+		position[node] = i
+	}
+	for _, from := range sut.Keys() {
+		for _, to := range sut.LookupKey(from) {
+			assert.Less(t, position[from], position[to], "%s should come before %s", from, to)
+		}
+	}
+}
+
+func TestTopoSortCycle(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("c", "a")
+
+	order, err := TopoSort(sut)
+
+	assert.ErrorIs(t, err, ErrCycle, "a cyclic graph cannot be sorted")
+	assert.Nil(t, order, "no ordering should be returned for a cyclic graph")
+}
+
+func TestLongestPath(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("c", "d")
+	sut.Add("a", "d")
+	sut.Add("x", "b")
+	sut.Add("d", "e")
+	sut.Add("y", "z")
+
+	path, err := LongestPath(sut)
+
+	assert.NoError(t, err, "a DAG should have a longest path")
+	assert.Equal(t, 5, len(path), "the longest path should have five nodes")
+	assert.Equal(t, []string{"b", "c", "d", "e"}, path[1:], "the longest path should go through b, c, d and e")
+	assert.Contains(t, []string{"a", "x"}, path[0], "the longest path should start at a source")
+
+	path, err = LongestPath(New[string, string]())
+	assert.NoError(t, err, "an empty graph has no cycles")
+	assert.Empty(t, path, "an empty graph has no paths")
+
+	sut.Add("e", "a")
+	_, err = LongestPath(sut)
+	assert.ErrorIs(t, err, ErrCycle, "a cyclic graph has no longest path")
+}
+
+func TestComponentCount(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("c", "b")
+	sut.Add("d", "e")
+	sut.Add("e", "f")
+	sut.Add("f", "d")
+	sut.Add("g", "g")
+
+	assert.Equal(t, 3, ComponentCount(sut), "there should be three disjoint clusters")
+	assert.Equal(t, 0, ComponentCount(New[string, string]()), "an empty graph has no components")
+}
+
+func TestShortestPath(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("c", "d")
+	sut.Add("a", "e")
+	sut.Add("e", "d")
+	sut.Add("x", "a")
+
+	path, found := ShortestPath(sut, "a", "d")
+	assert.True(t, found, "d should be reachable from a")
+	assert.Equal(t, []string{"a", "e", "d"}, path, "the shortest path should be returned")
+
+	path, found = ShortestPath(sut, "a", "a")
+	assert.True(t, found, "a node should be reachable from itself")
+	assert.Equal(t, []string{"a"}, path, "the path from a node to itself only contains the node")
+
+	path, found = ShortestPath(sut, "d", "a")
+	assert.False(t, found, "edges should only be followed forward")
+	assert.Nil(t, path, "no path should be returned for unreachable nodes")
+
+	path, found = ShortestPath(sut, "d", "d")
+	assert.True(t, found, "a node that is only a value should be reachable from itself")
+	assert.Equal(t, []string{"d"}, path, "the path from a node to itself only contains the node")
+
+	path, found = ShortestPath(sut, "z", "z")
+	assert.False(t, found, "a node that is not in the map should not be reachable from itself")
+	assert.Nil(t, path, "no path should be returned for a node that is not in the map")
+}
+
+func TestWriteDOT(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	sut.Add("key \"3\"", "value3")
+
+	var b strings.Builder
+	err := WriteDOT(sut, &b, "test graph")
+
+	assert.NoError(t, err, "writing to a strings.Builder should not fail")
+	assert.Equal(t, `digraph "test graph" {
+	"key \"3\"" -> "value3";
+	"key1" -> "value1";
+	"key1" -> "value2";
+	"key2" -> "value1";
+	"key2" -> "value2";
+}
+`, b.String(), "there should be one edge per key/value pair, with quoted labels")
+}
+
+func TestWriteDOTEscaping(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("café", "a\\b")
+	sut.Add("tab\there", "\"quoted\"")
+
+	var b strings.Builder
+	assert.NoError(t, WriteDOT(sut, &b, "naïve"), "writing to a strings.Builder should not fail")
+	assert.Equal(t, "digraph \"naïve\" {\n"+
+		"\t\"café\" -> \"a\\\\b\";\n"+
+		"\t\"tab\there\" -> \"\\\"quoted\\\"\";\n"+
+		"}\n", b.String(), "only quotes and backslashes should be escaped")
+}
+
+func TestIdentity(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "a")
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("c", "c")
+
+	assert.ElementsMatch(t, []string{"a", "c"}, Identity(sut), "only nodes with self-loops should be returned")
+}
+
+func TestWithoutSelfLoops(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "a")
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("c", "c")
+
+	res := WithoutSelfLoops(sut)
+
+	assert.ElementsMatch(t, []string{"b"}, res.LookupKey("a"), "the self-loop on a should be removed")
+	assert.ElementsMatch(t, []string{"c"}, res.LookupKey("b"), "other edges should remain")
+	assert.False(t, res.KeyExists("c"), "a node whose only edge was a self-loop should have no outgoing edges")
+	assert.ElementsMatch(t, []string{"b"}, res.LookupValue("c"), "the inverse should not contain self-loops")
+	assert.ElementsMatch(t, []string{"a", "c"}, Identity(sut), "the original map should not be modified")
+}
+
+func TestBridges(t *testing.T) {
+	sut := New[string, string]()
+	// Triangle a-b-c connected to triangle d-e-f through the bridge c -> d
+	sut.Add("a", "b")
+	sut.Add("b", "c")
+	sut.Add("c", "a")
+	sut.Add("c", "d")
+	sut.Add("d", "e")
+	sut.Add("e", "f")
+	sut.Add("f", "d")
+	// Opposite edges are not bridges, self-loops are ignored and g is only reachable through f -> g
+	sut.Add("a", "x")
+	sut.Add("x", "a")
+	sut.Add("x", "x")
+	sut.Add("f", "g")
+
+	bridges := Bridges(sut)
+
+	assert.ElementsMatch(t, []Pair[string, string]{
+		{Key: "c", Value: "d"},
+		{Key: "f", Value: "g"},
+	}, bridges, "only the edges that disconnect the graph should be returned")
+}
+
+func TestMaximalCliques(t *testing.T) {
+	sut := New[string, string]()
+	// Triangle a-b-c with the edges in both directions, a tail c -> d and a node e with only a self-loop
+	sut.Add("a", "b")
+	sut.Add("b", "a")
+	sut.Add("b", "c")
+	sut.Add("c", "a")
+	sut.Add("c", "d")
+	sut.Add("e", "e")
+
+	cliques := MaximalCliques(sut)
+	for _, clique := range cliques {
+		slices.Sort(clique)
+	}
+
+	assert.ElementsMatch(t, [][]string{
+		{"a", "b", "c"},
+		{"c", "d"},
+		{"e"},
+	}, cliques, "the triangle, the tail and the isolated node should be the maximal cliques")
+	assert.Empty(t, MaximalCliques(New[string, string]()), "an empty graph has no cliques")
+}
+
+func TestReverseEdge(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("a", "c")
+
+	assert.True(t, ReverseEdge(sut, "a", "b"), "reversing an existing edge should succeed")
+	assert.ElementsMatch(t, []string{"c"}, sut.LookupKey("a"), "the original edge should be removed")
+	assert.ElementsMatch(t, []string{"a"}, sut.LookupKey("b"), "the reversed edge should be added")
+	assert.ElementsMatch(t, []string{"b"}, sut.LookupValue("a"), "the inverse should reflect the reversed edge")
+	assert.False(t, sut.ValueExists("b"), "b should no longer be a target")
+
+	assert.False(t, ReverseEdge(sut, "a", "b"), "reversing a nonexistent edge should fail")
+	assert.ElementsMatch(t, []string{"a"}, sut.LookupKey("b"), "a failed reversal should not change the map")
+}
+
+func TestUndirectedCanonical(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("b", "a")
+	sut.Add("c", "b")
+	sut.Add("c", "c")
+
+	res := UndirectedCanonical(sut)
+
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, res.Keys(), "every edge should start at its smaller node")
+	assert.ElementsMatch(t, []string{"b"}, res.LookupKey("a"), "a -> b and b -> a should collapse into a single edge")
+	assert.ElementsMatch(t, []string{"c"}, res.LookupKey("b"), "c -> b should be stored as b -> c")
+	assert.ElementsMatch(t, []string{"c"}, res.LookupKey("c"), "self-loops should be kept")
+	assert.ElementsMatch(t, []string{"a"}, sut.LookupKey("b"), "the original map should not be modified")
+}
+
+func TestUndirectedCanonicalFunc(t *testing.T) {
+	type node struct{ id int }
+	sut := New[node, node]()
+	sut.Add(node{1}, node{2})
+	sut.Add(node{2}, node{1})
+
+	res := UndirectedCanonicalFunc(sut, func(a, b node) bool { return a.id > b.id })
+
+	assert.Equal(t, []node{{2}}, res.Keys(), "the comparator should decide the direction")
+	assert.Equal(t, []node{{1}}, res.LookupKey(node{2}), "both edges should collapse into one")
+}
+
+func TestDegreeCentrality(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("a", "b")
+	sut.Add("a", "c")
+	sut.Add("b", "c")
+	sut.Add("c", "a")
+	sut.Add("d", "d")
+
+	assert.Equal(t, map[string]int{
+		"a": 3,
+		"b": 2,
+		"c": 3,
+		"d": 2,
+	}, DegreeCentrality(sut), "each node's degree should be its out-degree plus its in-degree")
+}
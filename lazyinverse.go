@@ -0,0 +1,58 @@
+package bimultimap
+
+// NewLazyInverse creates a new, empty BiMultiMap that does not maintain the inverse index on every
+// change. Instead, the keys of a value are looked up in the forward index the first time they are
+// needed and cached until the next change that involves that value. This makes adding and deleting
+// pairs cheaper at the cost of slower lookups by value, so it suits workloads where LookupValue is
+// rare. The keys of a value are returned in no particular order, so FirstKey returns an arbitrary key
+func NewLazyInverse[K comparable, V comparable]() *BiMultiMap[K, V] {
+	m := New[K, V]()
+	m.lazyInverse = true
+	return m
+}
+
+// keysOf returns the keys associated with a value, or nil if the value does not exist. The returned
+// slice must not be modified. The caller must hold the read or the write lock
+func (m *BiMultiMap[K, V]) keysOf(value V) []K {
+	if !m.lazyInverse {
+		return m.inverse[value]
+	}
+
+	// Several readers can hold the read lock at the same time, so the cache needs its own lock
+	m.inverseMutex.Lock()
+	defer m.inverseMutex.Unlock()
+
+	if keys, found := m.inverse[value]; found {
+		return keys
+	}
+
+	var keys []K
+	for k, values := range m.forward {
+		for _, v := range values {
+			if v == value {
+				keys = append(keys, k)
+			}
+		}
+	}
+	if len(keys) > 0 {
+		m.inverse[value] = keys
+	}
+	return keys
+}
+
+// inverseIndex returns the complete inverse index. For maps created with NewLazyInverse it is built
+// from the forward index on every call. The returned map must not be modified. The caller must hold
+// the read or the write lock
+func (m *BiMultiMap[K, V]) inverseIndex() map[V][]K {
+	if !m.lazyInverse {
+		return m.inverse
+	}
+
+	inverse := make(map[V][]K)
+	for k, values := range m.forward {
+		for _, v := range values {
+			inverse[v] = append(inverse[v], k)
+		}
+	}
+	return inverse
+}
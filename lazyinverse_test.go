@@ -0,0 +1,83 @@
+package bimultimap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyInverseMatchesEager(t *testing.T) {
+	eager := New[string, string]()
+	sut := NewLazyInverse[string, string]()
+
+	assertSame := func(msg string) {
+		t.Helper()
+		assert.ElementsMatch(t, eager.Values(), sut.Values(), msg)
+		for _, v := range eager.Values() {
+			assert.ElementsMatch(t, eager.LookupValue(v), sut.LookupValue(v), msg)
+		}
+		assert.False(t, sut.ValueExists("value9"), msg)
+	}
+
+	for _, m := range []*BiMultiMap[string, string]{eager, sut} {
+		m.Add("key1", "value1")
+		m.Add("key1", "value2")
+		m.Add("key2", "value1")
+		m.Add("key3", "value3")
+	}
+	assertSame("the keys of each value should match after adding")
+
+	for _, m := range []*BiMultiMap[string, string]{eager, sut} {
+		m.Add("key3", "value1")
+		m.DeleteKeyValue("key1", "value2")
+	}
+	assertSame("cached keys should be invalidated by changes to the value")
+
+	for _, m := range []*BiMultiMap[string, string]{eager, sut} {
+		m.DeleteKey("key2")
+		m.DeleteValue("value3")
+	}
+	assertSame("deleting keys and values should be reflected")
+	assert.False(t, sut.ValueExists("value3"), "a deleted value should not exist")
+	assert.ElementsMatch(t, []string{"key1", "key3"}, sut.LookupValue("value1"), "the remaining keys should be found")
+}
+
+func TestLazyInverseConcurrentLookups(t *testing.T) {
+	sut := NewLazyInverse[int, int]()
+	for i := 0; i < 100; i++ {
+		sut.Add(i, i%10)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := 0; v < 10; v++ {
+				assert.Len(t, sut.LookupValue(v), 10, "every value should have 10 keys")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkAddEagerInverse(b *testing.B) {
+	benchmarkRareValueLookups(b, New[int, int])
+}
+
+func BenchmarkAddLazyInverse(b *testing.B) {
+	benchmarkRareValueLookups(b, NewLazyInverse[int, int])
+}
+
+func benchmarkRareValueLookups(b *testing.B, newMap func() *BiMultiMap[int, int]) {
+	for i := 0; i < b.N; i++ {
+		m := newMap()
+		for j := 0; j < 10000; j++ {
+			m.Add(j/4, j%1000)
+			if j%5000 == 0 {
+				m.LookupValue(j % 1000)
+			}
+		}
+	}
+}
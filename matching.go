@@ -0,0 +1,104 @@
+package bimultimap
+
+import (
+	"math"
+)
+
+// MaximumMatching returns a maximum-cardinality matching of the bipartite graph formed by the keys,
+// the values and the associations between them: as many key/value pairs as possible such that no key
+// and no value appears in more than one of them. When there are several maximum matchings, which one
+// is returned is unspecified. It uses the Hopcroft-Karp algorithm
+func (m *BiMultiMap[K, V]) MaximumMatching() []Pair[K, V] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	// Number the keys and values so the algorithm can work on slices
+	keys := make([]K, 0, len(m.forward))
+	inverse := m.inverseIndex()
+	values := make([]V, 0, len(inverse))
+	valueIndex := make(map[V]int, len(inverse))
+	for v := range inverse {
+		valueIndex[v] = len(values)
+		values = append(values, v)
+	}
+	adjacent := make([][]int, 0, len(m.forward))
+	for k, vs := range m.forward {
+		keys = append(keys, k)
+		adjacent = append(adjacent, make([]int, 0, len(vs)))
+		for _, v := range vs {
+			adjacent[len(adjacent)-1] = append(adjacent[len(adjacent)-1], valueIndex[v])
+		}
+	}
+
+	const free = -1
+	const infinity = math.MaxInt
+	matchKey := make([]int, len(keys))
+	for i := range matchKey {
+		matchKey[i] = free
+	}
+	matchValue := make([]int, len(values))
+	for i := range matchValue {
+		matchValue[i] = free
+	}
+	dist := make([]int, len(keys))
+
+	// bfs layers the graph starting from the free keys, and reports whether an augmenting path exists
+	bfs := func() bool {
+		queue := make([]int, 0, len(keys))
+		for k := range keys {
+			if matchKey[k] == free {
+				dist[k] = 0
+				queue = append(queue, k)
+			} else {
+				dist[k] = infinity
+			}
+		}
+
+		found := false
+		for len(queue) > 0 {
+			k := queue[0]
+			queue = queue[1:]
+			for _, v := range adjacent[k] {
+				next := matchValue[v]
+				if next == free {
+					found = true
+				} else if dist[next] == infinity {
+					dist[next] = dist[k] + 1
+					queue = append(queue, next)
+				}
+			}
+		}
+		return found
+	}
+
+	// dfs looks for an augmenting path from a key along the layers built by bfs
+	var dfs func(k int) bool
+	dfs = func(k int) bool {
+		for _, v := range adjacent[k] {
+			next := matchValue[v]
+			if next == free || (dist[next] == dist[k]+1 && dfs(next)) {
+				matchKey[k] = v
+				matchValue[v] = k
+				return true
+			}
+		}
+		dist[k] = infinity
+		return false
+	}
+
+	for bfs() {
+		for k := range keys {
+			if matchKey[k] == free {
+				dfs(k)
+			}
+		}
+	}
+
+	res := make([]Pair[K, V], 0)
+	for k, v := range matchKey {
+		if v != free {
+			res = append(res, Pair[K, V]{Key: keys[k], Value: values[v]})
+		}
+	}
+	return res
+}
@@ -0,0 +1,39 @@
+package bimultimap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaximumMatching(t *testing.T) {
+	sut := New[string, string]()
+	sut.Add("key1", "a")
+	sut.Add("key1", "b")
+	sut.Add("key2", "a")
+	sut.Add("key3", "b")
+	sut.Add("key3", "c")
+	sut.Add("key3", "d")
+	sut.Add("key4", "c")
+	sut.Add("key5", "a")
+
+	matching := sut.MaximumMatching()
+
+	// key2 and key5 can only use a, so one of them stays unmatched
+	assert.Len(t, matching, 4, "the matching should have the maximum size")
+	keys := make(map[string]struct{})
+	values := make(map[string]struct{})
+	for _, p := range matching {
+		assert.Contains(t, sut.LookupKey(p.Key), p.Value, "every matched pair should exist in the map")
+		assert.NotContains(t, keys, p.Key, "every key should be matched at most once")
+		assert.NotContains(t, values, p.Value, "every value should be matched at most once")
+		keys[p.Key] = struct{}{}
+		values[p.Value] = struct{}{}
+	}
+}
+
+func TestMaximumMatchingEmpty(t *testing.T) {
+	sut := New[string, string]()
+
+	assert.Empty(t, sut.MaximumMatching(), "an empty map has an empty matching")
+}
@@ -0,0 +1,76 @@
+package bimultimap
+
+import (
+	"cmp"
+	"slices"
+)
+
+// NewOrdered creates a new, empty BiMultiMap that keeps track of the order in which keys and
+// key/value pairs are added, so that OrderedKeys and OrderedPairs can return them in a stable order
+// that does not depend on Go's map iteration order
+func NewOrdered[K comparable, V comparable]() *BiMultiMap[K, V] {
+	m := New[K, V]()
+	m.ordered = true
+	m.keyOrder = make(map[K]uint64)
+	m.pairOrder = make(map[Pair[K, V]]uint64)
+	return m
+}
+
+// OrderedKeys returns the map's keys in the order in which they were first added. A key that is
+// removed and added again moves to the end. For maps not created with NewOrdered the order is
+// unspecified
+func (m *BiMultiMap[K, V]) OrderedKeys() []K {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.orderedKeys()
+}
+
+// orderedKeys implements OrderedKeys. The caller must hold the read or the write lock
+func (m *BiMultiMap[K, V]) orderedKeys() []K {
+	keys := make([]K, 0, len(m.forward))
+	for k := range m.forward {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b K) int {
+		return cmp.Compare(m.keyOrder[a], m.keyOrder[b])
+	})
+	return keys
+}
+
+// OrderedPairs returns the map's key/value pairs in the order in which they were added. A pair that
+// is removed and added again moves to the end. For maps not created with NewOrdered the order is
+// unspecified
+func (m *BiMultiMap[K, V]) OrderedPairs() []Pair[K, V] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	pairs := m.pairs()
+	slices.SortFunc(pairs, func(a, b Pair[K, V]) int {
+		return cmp.Compare(m.pairOrder[a], m.pairOrder[b])
+	})
+	return pairs
+}
+
+// RoundRobinPairs returns the map's key/value pairs interleaved across keys: the first value of every
+// key, then the second value of every key, and so on, skipping keys that have run out of values. The
+// values of each key are taken in the order in which they were added, and the keys in the order of
+// OrderedKeys, which is only stable for maps created with NewOrdered
+func (m *BiMultiMap[K, V]) RoundRobinPairs() []Pair[K, V] {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := m.orderedKeys()
+	res := make([]Pair[K, V], 0)
+	for i := 0; len(keys) > 0; i++ {
+		remaining := keys[:0]
+		for _, k := range keys {
+			if i < len(m.forward[k]) {
+				res = append(res, Pair[K, V]{Key: k, Value: m.forward[k][i]})
+				remaining = append(remaining, k)
+			}
+		}
+		keys = remaining
+	}
+	return res
+}
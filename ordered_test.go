@@ -0,0 +1,71 @@
+package bimultimap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedKeys(t *testing.T) {
+	sut := NewOrdered[string, int]()
+	expected := make([]string, 0, 50)
+	for i := 50; i > 0; i-- {
+		key := fmt.Sprintf("key%d", i)
+		sut.Add(key, i)
+		sut.Add(key, i+1)
+		expected = append(expected, key)
+	}
+
+	assert.Equal(t, expected, sut.OrderedKeys(), "keys should be returned in insertion order")
+
+	sut.DeleteKey("key50")
+	sut.Add("key50", 0)
+	assert.Equal(t, append(expected[1:], "key50"), sut.OrderedKeys(), "a key added again should move to the end")
+}
+
+func TestOrderedPairs(t *testing.T) {
+	sut := NewOrdered[string, string]()
+	sut.Add("key2", "value1")
+	sut.Add("key1", "value2")
+	sut.Add("key2", "value3")
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value1")
+
+	assert.Equal(t, []Pair[string, string]{
+		{Key: "key2", Value: "value1"},
+		{Key: "key1", Value: "value2"},
+		{Key: "key2", Value: "value3"},
+		{Key: "key1", Value: "value1"},
+	}, sut.OrderedPairs(), "pairs should be returned in insertion order")
+
+	sut.DeleteValue("value1")
+	assert.Equal(t, []Pair[string, string]{
+		{Key: "key1", Value: "value2"},
+		{Key: "key2", Value: "value3"},
+	}, sut.OrderedPairs(), "deleted pairs should not be returned")
+
+	sut.Clear()
+	assert.Empty(t, sut.OrderedPairs(), "a cleared map should have no pairs")
+	assert.Empty(t, sut.OrderedKeys(), "a cleared map should have no keys")
+}
+
+func TestRoundRobinPairs(t *testing.T) {
+	sut := NewOrdered[string, string]()
+	sut.Add("key1", "a1")
+	sut.Add("key2", "b1")
+	sut.Add("key1", "a2")
+	sut.Add("key3", "c1")
+	sut.Add("key1", "a3")
+	sut.Add("key3", "c2")
+
+	assert.Equal(t, []Pair[string, string]{
+		{Key: "key1", Value: "a1"},
+		{Key: "key2", Value: "b1"},
+		{Key: "key3", Value: "c1"},
+		{Key: "key1", Value: "a2"},
+		{Key: "key3", Value: "c2"},
+		{Key: "key1", Value: "a3"},
+	}, sut.RoundRobinPairs(), "pairs should be interleaved across keys")
+	assert.Empty(t, New[string, string]().RoundRobinPairs(), "an empty map has no pairs")
+}
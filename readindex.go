@@ -0,0 +1,70 @@
+package bimultimap
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// ReadIndexed wraps a BiMultiMap for read-heavy workloads. BuildReadIndex precomputes the sorted,
+// deduplicated values of every key so that LookupKey can return them without any per-call work. The
+// index is invalidated by the next change to the underlying map, after which LookupKey computes the
+// result on every call until BuildReadIndex is called again
+type ReadIndexed[K comparable, V cmp.Ordered] struct {
+	m *BiMultiMap[K, V]
+
+	mutex   sync.RWMutex
+	index   map[K][]V
+	version uint64
+}
+
+// NewReadIndexed creates a ReadIndexed wrapper around a map. The index is initially empty
+func NewReadIndexed[K comparable, V cmp.Ordered](m *BiMultiMap[K, V]) *ReadIndexed[K, V] {
+	return &ReadIndexed[K, V]{m: m}
+}
+
+// Map returns the underlying map
+func (r *ReadIndexed[K, V]) Map() *BiMultiMap[K, V] {
+	return r.m
+}
+
+// BuildReadIndex precomputes the sorted, deduplicated values of every key in the underlying map
+func (r *ReadIndexed[K, V]) BuildReadIndex() {
+	r.m.mutex.RLock()
+	version := r.m.version
+	index := make(map[K][]V, len(r.m.forward))
+	for k, values := range r.m.forward {
+		index[k] = sortedUnique(values)
+	}
+	r.m.mutex.RUnlock()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.index = index
+	r.version = version
+}
+
+// LookupKey gets the sorted, deduplicated values associated with a key, or an empty slice if the
+// key does not exist. When the index is up to date the returned slice is shared with the index and
+// must not be modified
+func (r *ReadIndexed[K, V]) LookupKey(key K) []V {
+	r.mutex.RLock()
+	index, version := r.index, r.version
+	r.mutex.RUnlock()
+
+	if index != nil && r.m.Version() == version {
+		if values, found := index[key]; found {
+			return values
+		}
+		return make([]V, 0)
+	}
+	return sortedUnique(r.m.LookupKey(key))
+}
+
+// Helper function: return a sorted copy of a slice without duplicates
+func sortedUnique[T cmp.Ordered](slice []T) []T {
+	res := slices.Clone(slice)
+	slices.Sort(res)
+	return slices.Compact(res)
+}
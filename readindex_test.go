@@ -0,0 +1,67 @@
+package bimultimap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadIndexed(t *testing.T) {
+	m := New[string, string]()
+	m.Add("key", "value3")
+	m.Add("key", "value1")
+	m.Add("key", "value2")
+	sut := NewReadIndexed(m)
+
+	sut.BuildReadIndex()
+	assert.Equal(t, []string{"value1", "value2", "value3"}, sut.LookupKey("key"), "the values should be sorted")
+	assert.Equal(t, []string{}, sut.LookupKey("missing"), "a nonexistent key should return an empty slice")
+
+	m.Add("key", "value0")
+	assert.Equal(t, []string{"value0", "value1", "value2", "value3"}, sut.LookupKey("key"), "a change to the map should invalidate the index")
+
+	sut.BuildReadIndex()
+	assert.Equal(t, []string{"value0", "value1", "value2", "value3"}, sut.LookupKey("key"), "the rebuilt index should be up to date")
+}
+
+func TestReadIndexedMultiset(t *testing.T) {
+	m := NewMultiset[string, int]()
+	m.Add("key", 2)
+	m.Add("key", 1)
+	m.Add("key", 2)
+	sut := NewReadIndexed(m)
+
+	assert.Equal(t, []int{1, 2}, sut.LookupKey("key"), "values should be deduplicated without an index")
+	sut.BuildReadIndex()
+	assert.Equal(t, []int{1, 2}, sut.LookupKey("key"), "values should be deduplicated with an index")
+}
+
+func BenchmarkReadIndexedLookupKey(b *testing.B) {
+	sut := NewReadIndexed(benchmarkLookupMap())
+	sut.BuildReadIndex()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sut.LookupKey(fmt.Sprintf("key%d", i%100))
+	}
+}
+
+func BenchmarkReadIndexedLookupKeyWithoutIndex(b *testing.B) {
+	sut := NewReadIndexed(benchmarkLookupMap())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sut.LookupKey(fmt.Sprintf("key%d", i%100))
+	}
+}
+
+func benchmarkLookupMap() *BiMultiMap[string, int] {
+	m := New[string, int]()
+	for i := 0; i < 100; i++ {
+		for j := 100; j > 0; j-- {
+			m.Add(fmt.Sprintf("key%d", i), j)
+		}
+	}
+	return m
+}
@@ -0,0 +1,51 @@
+package bimultimap
+
+import (
+	"slices"
+	"time"
+)
+
+// NewWithClock creates a new, empty BiMultiMap that records when each key was last modified, i.e.
+// when a value was last added to or removed from it, so that KeysByRecency can order the keys. now is
+// used to get the current time and defaults to time.Now if nil
+func NewWithClock[K comparable, V comparable](now func() time.Time) *BiMultiMap[K, V] {
+	if now == nil {
+		now = time.Now
+	}
+
+	m := New[K, V]()
+	m.now = now
+	m.modifiedAt = make(map[K]time.Time)
+	return m
+}
+
+// KeysByRecency returns the map's keys from the least to the most recently modified, which makes it
+// easy to pick keys for LRU-style eviction. Keys modified at the same time are returned in no
+// particular order. For maps not created with NewWithClock the order is unspecified
+func (m *BiMultiMap[K, V]) KeysByRecency() []K {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	keys := make([]K, 0, len(m.forward))
+	for k := range m.forward {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b K) int {
+		return m.modifiedAt[a].Compare(m.modifiedAt[b])
+	})
+	return keys
+}
+
+// keyModified records that a key has been modified in a map created with NewWithClock. The caller
+// must hold the write lock
+func (m *BiMultiMap[K, V]) keyModified(key K) {
+	if m.modifiedAt == nil {
+		return
+	}
+
+	if _, found := m.forward[key]; found {
+		m.modifiedAt[key] = m.now()
+	} else {
+		delete(m.modifiedAt, key)
+	}
+}
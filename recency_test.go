@@ -0,0 +1,35 @@
+package bimultimap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeysByRecency(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithClock[string, string](func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value1")
+	sut.Add("key3", "value1")
+	assert.Equal(t, []string{"key1", "key2", "key3"}, sut.KeysByRecency(), "keys should be ordered by when they were added")
+
+	sut.Add("key1", "value2")
+	sut.DeleteKeyValue("key2", "value1")
+	sut.Add("key2", "value2")
+	sut.DeleteKeyValue("key3", "value1")
+	assert.Equal(t, []string{"key1", "key2"}, sut.KeysByRecency(), "modified keys should move to the end and deleted keys should disappear")
+
+	sut.Add("key1", "value2")
+	assert.Equal(t, []string{"key1", "key2"}, sut.KeysByRecency(), "adding an existing pair should not count as a modification")
+
+	sut.DeleteValue("value2")
+	sut.Add("key3", "value3")
+	sut.Add("key1", "value3")
+	assert.Equal(t, []string{"key3", "key1"}, sut.KeysByRecency(), "removing a value should modify its keys")
+}
@@ -0,0 +1,90 @@
+package bimultimap
+
+import (
+	"slices"
+	"sync"
+)
+
+// MutationEvent is sent to subscribers when a key/value pair is added to or removed from a map
+type MutationEvent[K comparable, V comparable] struct {
+	Kind  ChangeKind
+	Key   K
+	Value V
+}
+
+// subscriber is a channel created by Subscribe. closed is guarded by mutex so that the channel is
+// never sent to after it has been closed
+type subscriber[K comparable, V comparable] struct {
+	ch     chan MutationEvent[K, V]
+	mutex  sync.Mutex
+	closed bool
+}
+
+// Subscribe returns a channel that receives an event every time a key/value pair is added to or
+// removed from the map, and a function that cancels the subscription and closes the channel. Events
+// are sent after the map's lock has been released, in the order in which the changes happened. To
+// avoid blocking writers, events are dropped when the channel's buffer (of the given size) is full
+func (m *BiMultiMap[K, V]) Subscribe(buffer int) (<-chan MutationEvent[K, V], func()) {
+	s := &subscriber[K, V]{ch: make(chan MutationEvent[K, V], buffer)}
+
+	m.mutex.Lock()
+	m.subscribers = append(m.subscribers, s)
+	m.mutex.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			m.mutex.Lock()
+			m.subscribers = slices.DeleteFunc(m.subscribers, func(other *subscriber[K, V]) bool {
+				return other == s
+			})
+			m.mutex.Unlock()
+
+			s.mutex.Lock()
+			s.closed = true
+			close(s.ch)
+			s.mutex.Unlock()
+		})
+	}
+
+	return s.ch, unsubscribe
+}
+
+// notify queues an event for the subscribers, if there are any. The caller must hold the write lock,
+// and release it with unlock so that the event is delivered
+func (m *BiMultiMap[K, V]) notify(kind ChangeKind, key K, value V) {
+	if len(m.subscribers) > 0 {
+		m.pending = append(m.pending, MutationEvent[K, V]{Kind: kind, Key: key, Value: value})
+	}
+}
+
+// unlock releases the write lock and then delivers the events queued while it was held. The delivery
+// lock is acquired before the write lock is released so that events reach the subscribers in order
+func (m *BiMultiMap[K, V]) unlock() {
+	if len(m.pending) == 0 {
+		m.mutex.Unlock()
+		return
+	}
+
+	events := m.pending
+	subscribers := slices.Clone(m.subscribers)
+	m.pending = nil
+
+	m.delivery.Lock()
+	defer m.delivery.Unlock()
+	m.mutex.Unlock()
+
+	for _, s := range subscribers {
+		s.mutex.Lock()
+		for _, e := range events {
+			if s.closed {
+				break
+			}
+			select {
+			case s.ch <- e:
+			default:
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
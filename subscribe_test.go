@@ -0,0 +1,50 @@
+package bimultimap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	sut := New[string, string]()
+	events, unsubscribe := sut.Subscribe(10)
+
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value1")
+	sut.Add("key1", "value2")
+	sut.DeleteKey("key1")
+
+	expected := []MutationEvent[string, string]{
+		{Kind: PairAdded, Key: "key1", Value: "value1"},
+		{Kind: PairAdded, Key: "key1", Value: "value2"},
+		{Kind: PairRemoved, Key: "key1", Value: "value1"},
+		{Kind: PairRemoved, Key: "key1", Value: "value2"},
+	}
+	for _, e := range expected {
+		assert.Equal(t, e, <-events, "events should be received in order, without duplicate Adds")
+	}
+
+	unsubscribe()
+	sut.Add("key2", "value2")
+
+	_, open := <-events
+	assert.False(t, open, "unsubscribing should close the channel without further events")
+	assert.NotPanics(t, unsubscribe, "unsubscribing twice should be harmless")
+}
+
+func TestSubscribeFullBuffer(t *testing.T) {
+	sut := New[string, string]()
+	events, unsubscribe := sut.Subscribe(1)
+	defer unsubscribe()
+
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value2")
+
+	assert.Equal(t, MutationEvent[string, string]{Kind: PairAdded, Key: "key1", Value: "value1"}, <-events, "the first event should be buffered")
+	select {
+	case e := <-events:
+		assert.Fail(t, "events should be dropped when the buffer is full", "got %v", e)
+	default:
+	}
+}
@@ -0,0 +1,111 @@
+package bimultimap
+
+import (
+	"time"
+)
+
+// expiry records when a key/value pair was added to a map created with NewWithTTL
+type expiry[K comparable, V comparable] struct {
+	key   K
+	value V
+	at    time.Time
+}
+
+// NewWithTTL creates a new, empty BiMultiMap whose key/value pairs expire once ttl has elapsed since
+// they were last added. now is used to get the current time and defaults to time.Now if nil.
+//
+// Expired pairs are evicted lazily: Add and the methods that look up the pairs, keys or values of the
+// map (e.g. LookupKey, Contains, Keys, KeySet, Size or MarshalJSON) evict them before doing their work.
+// Other methods, such as the ones that analyze the structure of the map, may still see expired pairs
+// until one of those methods or EvictExpired is called
+func NewWithTTL[K comparable, V comparable](ttl time.Duration, now func() time.Time) *BiMultiMap[K, V] {
+	if now == nil {
+		now = time.Now
+	}
+
+	m := New[K, V]()
+	m.ttl = ttl
+	m.now = now
+	m.addedAt = make(map[K]map[V]time.Time)
+	return m
+}
+
+// EvictExpired deletes all expired key/value pairs from a map created with NewWithTTL and returns
+// how many were deleted. It is a no-op for other maps
+func (m *BiMultiMap[K, V]) EvictExpired() int {
+	if m.ttl == 0 {
+		return 0
+	}
+
+	m.mutex.Lock()
+	defer m.unlock()
+
+	return m.evictExpired()
+}
+
+// expire evicts the expired key/value pairs if there are any. The caller must not hold the lock
+func (m *BiMultiMap[K, V]) expire() {
+	if m.ttl == 0 {
+		return
+	}
+
+	// Check under the read lock first so that readers don't serialize when nothing has expired
+	m.mutex.RLock()
+	expired := len(m.expiries) > 0 && m.expired(m.expiries[0].at)
+	m.mutex.RUnlock()
+
+	if expired {
+		m.EvictExpired()
+	}
+}
+
+// evictExpired deletes all expired key/value pairs and returns how many were deleted. The caller
+// must hold the write lock
+func (m *BiMultiMap[K, V]) evictExpired() int {
+	evicted := 0
+
+	// Since all pairs share the same TTL, expiries is sorted by expiration time
+	for len(m.expiries) > 0 && m.expired(m.expiries[0].at) {
+		e := m.expiries[0]
+		m.expiries = m.expiries[1:]
+
+		// The pair may have been added again since this entry was recorded
+		if at, found := m.addedAt[e.key][e.value]; !found || !at.Equal(e.at) {
+			continue
+		}
+
+		delete(m.addedAt[e.key], e.value)
+		if len(m.addedAt[e.key]) == 0 {
+			delete(m.addedAt, e.key)
+		}
+
+		if m.deleteKeyValue(e.key, e.value) {
+			evicted++
+		}
+	}
+
+	if len(m.expiries) == 0 {
+		m.expiries = nil
+	}
+
+	return evicted
+}
+
+// touch records that a key/value pair was added now. The caller must hold the write lock
+func (m *BiMultiMap[K, V]) touch(key K, value V) {
+	at := m.now()
+
+	times, found := m.addedAt[key]
+	if !found {
+		times = make(map[V]time.Time)
+		m.addedAt[key] = times
+	}
+	times[value] = at
+
+	m.expiries = append(m.expiries, expiry[K, V]{key: key, value: value, at: at})
+}
+
+// expired returns true if a pair added at the given time has expired
+func (m *BiMultiMap[K, V]) expired(at time.Time) bool {
+	return !m.now().Before(at.Add(m.ttl))
+}
@@ -0,0 +1,112 @@
+package bimultimap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+
+	sut.Add("key", "value1")
+	now = now.Add(30 * time.Second)
+	sut.Add("key", "value2")
+
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key"), "no pair should have expired yet")
+
+	now = now.Add(30 * time.Second)
+	assert.ElementsMatch(t, []string{"value2"}, sut.LookupKey("key"), "value1 should have expired")
+	assert.False(t, sut.ValueExists("value1"), "an expired value should be removed from the inverse")
+
+	now = now.Add(30 * time.Second)
+	assert.False(t, sut.KeyExists("key"), "a key whose pairs have all expired should disappear")
+	assert.Empty(t, sut.Keys(), "there should be no keys left")
+	assert.Empty(t, sut.Values(), "there should be no values left")
+}
+
+func TestTTLReAddRefreshes(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+
+	sut.Add("key", "value")
+	now = now.Add(45 * time.Second)
+	sut.Add("key", "value")
+	now = now.Add(45 * time.Second)
+
+	assert.ElementsMatch(t, []string{"value"}, sut.LookupKey("key"), "adding a pair again should restart its TTL")
+	assert.ElementsMatch(t, []string{"key"}, sut.LookupValue("value"), "the pair should not be duplicated")
+
+	now = now.Add(15 * time.Second)
+	assert.ElementsMatch(t, []string{}, sut.LookupKey("key"), "the pair should expire after the restarted TTL")
+}
+
+func TestTTLEvictExpired(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+
+	sut.Add("key1", "value1")
+	sut.Add("key2", "value2")
+	sut.DeleteKey("key2")
+	now = now.Add(time.Minute)
+
+	assert.Equal(t, 1, sut.EvictExpired(), "only pairs still in the map should be counted")
+	assert.Equal(t, 0, New[string, string]().EvictExpired(), "a map without TTL never evicts anything")
+}
+
+func TestTTLMergeAfterExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Second, func() time.Time { return now })
+
+	sut.Add("key1", "value1")
+	now = now.Add(500 * time.Millisecond)
+	sut.Add("key2", "value2")
+	now = now.Add(600 * time.Millisecond)
+
+	other := New[string, string]()
+	other.Add("key3", "value3")
+
+	res := sut.Merge(other)
+	assert.ElementsMatch(t, []string{"key2", "key3"}, res.Keys(), "expired pairs should not be merged")
+	assert.ElementsMatch(t, []string{"key2"}, sut.Keys(), "merging should evict the expired pairs")
+}
+
+func TestTTLCopyKeyEntryAfterExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+
+	sut.Add("key", "value")
+	now = now.Add(time.Minute)
+
+	_, values, found := sut.CopyKeyEntry("key")
+	assert.False(t, found, "a key whose pairs have all expired should not be found")
+	assert.Empty(t, values, "expired values should not be copied")
+}
+
+func TestTTLKeySetValueSetAfterExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+
+	sut.Add("key1", "value1")
+	now = now.Add(30 * time.Second)
+	sut.Add("key2", "value2")
+	now = now.Add(30 * time.Second)
+
+	assert.Equal(t, map[string]struct{}{"key2": {}}, sut.KeySet(), "expired keys should not be in the key set")
+	assert.Equal(t, map[string]struct{}{"value2": {}}, sut.ValueSet(), "expired values should not be in the value set")
+}
+
+func TestTTLPairIndexAfterExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	sut := NewWithTTL[string, string](time.Minute, func() time.Time { return now })
+
+	sut.Add("key", "value1")
+	now = now.Add(30 * time.Second)
+	sut.Add("key", "value2")
+	now = now.Add(30 * time.Second)
+
+	assert.Equal(t, -1, sut.PairIndex("key", "value1"), "an expired pair should not be found")
+	assert.Equal(t, 0, sut.PairIndex("key", "value2"), "the remaining pair should move to the front")
+}
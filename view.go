@@ -0,0 +1,95 @@
+package bimultimap
+
+import "slices"
+
+// ReadOnlyBiMultiMap is the read-only subset of the BiMultiMap API
+type ReadOnlyBiMultiMap[K comparable, V comparable] interface {
+	// LookupKey gets a copy of the values associated with a key, or an empty slice if the key does not
+	// exist
+	LookupKey(key K) []V
+	// LookupValue gets a copy of the keys associated with a value, or an empty slice if the value does
+	// not exist
+	LookupValue(value V) []K
+	// KeyExists returns true if a key exists in the map
+	KeyExists(key K) bool
+	// ValueExists returns true if a value exists in the map
+	ValueExists(value V) bool
+	// Keys returns an unordered slice containing all of the map's keys
+	Keys() []K
+	// Values returns an unordered slice containing all of the map's values
+	Values() []V
+}
+
+var _ ReadOnlyBiMultiMap[string, string] = (*BiMultiMap[string, string])(nil)
+
+// View calls fn with a read-only view of the map, holding the read lock until fn returns. This makes
+// several reads consistent with each other without locking for each of them. The view reads the
+// live map without any locking, so fn must not mutate the map (which would deadlock) and must not
+// use the view from goroutines that outlive the call to fn
+func (m *BiMultiMap[K, V]) View(fn func(r ReadOnlyBiMultiMap[K, V])) {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	fn(&readView[K, V]{forward: m.forward, inverse: m.inverseIndex()})
+}
+
+// FrozenSnapshot returns an immutable copy of the map. The snapshot is independent of any later
+// changes to the map, and since it cannot be modified its methods do not need to lock
+func (m *BiMultiMap[K, V]) FrozenSnapshot() ReadOnlyBiMultiMap[K, V] {
+	m.expire()
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return &readView[K, V]{forward: cloneIndex(m.forward), inverse: cloneIndex(m.inverseIndex())}
+}
+
+// readView is a ReadOnlyBiMultiMap that reads a map's indexes without locking
+type readView[K comparable, V comparable] struct {
+	forward map[K][]V
+	inverse map[V][]K
+}
+
+func (r *readView[K, V]) LookupKey(key K) []V {
+	values, found := r.forward[key]
+	if !found {
+		return make([]V, 0)
+	}
+	return slices.Clone(values)
+}
+
+func (r *readView[K, V]) LookupValue(value V) []K {
+	keys, found := r.inverse[value]
+	if !found {
+		return make([]K, 0)
+	}
+	return slices.Clone(keys)
+}
+
+func (r *readView[K, V]) KeyExists(key K) bool {
+	_, found := r.forward[key]
+	return found
+}
+
+func (r *readView[K, V]) ValueExists(value V) bool {
+	_, found := r.inverse[value]
+	return found
+}
+
+func (r *readView[K, V]) Keys() []K {
+	keys := make([]K, 0, len(r.forward))
+	for k := range r.forward {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (r *readView[K, V]) Values() []V {
+	values := make([]V, 0, len(r.inverse))
+	for v := range r.inverse {
+		values = append(values, v)
+	}
+	return values
+}
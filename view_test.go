@@ -0,0 +1,59 @@
+package bimultimap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestView(t *testing.T) {
+	sut := biMultiMapWithMultipleKeysValues()
+	done := make(chan struct{})
+
+	sut.View(func(r ReadOnlyBiMultiMap[string, string]) {
+		// A concurrent writer has to wait until the view is released
+		go func() {
+			sut.Add("key3", "value3")
+			close(done)
+		}()
+
+		assert.ElementsMatch(t, []string{"key1", "key2"}, r.Keys(), "the view should show the map's keys")
+		assert.ElementsMatch(t, []string{"value1", "value2"}, r.Values(), "the view should show the map's values")
+		for _, k := range r.Keys() {
+			assert.True(t, r.KeyExists(k), "every key should exist")
+			for _, v := range r.LookupKey(k) {
+				assert.True(t, r.ValueExists(v), "every value of a key should exist")
+				assert.Contains(t, r.LookupValue(v), k, "the inverse should be consistent with the forward index")
+			}
+		}
+		assert.False(t, r.KeyExists("key3"), "concurrent writes should not be visible inside the view")
+		assert.ElementsMatch(t, []string{}, r.LookupKey("key3"), "a nonexistent key should return an empty slice")
+		assert.ElementsMatch(t, []string{}, r.LookupValue("value3"), "a nonexistent value should return an empty slice")
+	})
+
+	<-done
+	assert.True(t, sut.KeyExists("key3"), "the concurrent write should happen once the view is released")
+}
+
+func TestFrozenSnapshot(t *testing.T) {
+	source := biMultiMapWithMultipleKeysValues()
+	sut := source.FrozenSnapshot()
+
+	source.Add("key1", "value3")
+	source.DeleteKey("key2")
+
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.Keys(), "the snapshot should not see later changes")
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "the snapshot should not see later changes")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value1"), "the snapshot should not see later changes")
+	assert.False(t, sut.ValueExists("value3"), "the snapshot should not see later changes")
+
+	sut.LookupKey("key1")[0] = "changed"
+	sut.LookupValue("value1")[0] = "changed"
+	assert.ElementsMatch(t, []string{"value1", "value2"}, sut.LookupKey("key1"), "modifying the returned values should not affect the snapshot")
+	assert.ElementsMatch(t, []string{"key1", "key2"}, sut.LookupValue("value1"), "modifying the returned keys should not affect the snapshot")
+
+	_, mutable := sut.(interface{ Add(string, string) })
+	assert.False(t, mutable, "the snapshot should not have mutating methods")
+	_, mutable = sut.(interface{ DeleteKey(string) []string })
+	assert.False(t, mutable, "the snapshot should not have mutating methods")
+}